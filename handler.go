@@ -12,37 +12,81 @@ import (
 	"github.com/obnahsgnaw/application/service/regCenter"
 	"github.com/obnahsgnaw/http"
 	"github.com/obnahsgnaw/rpc/pkg/rpcclient"
+	bindv1 "github.com/obnahsgnaw/socketapi/gen/bind/v1"
 	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/conn"
 	"github.com/obnahsgnaw/sockethandler/service/proto/impl"
+	"github.com/obnahsgnaw/sockethandler/service/session"
 	"github.com/obnahsgnaw/sockethandler/sockettype"
 	"github.com/obnahsgnaw/socketutil/codec"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultDrainTimeout the default max wait of the in-flight actions when releasing
+const DefaultDrainTimeout = 10 * time.Second
+
+// closeAction the action id 0 is the connection close action
+var closeAction = codec.Action{Id: 0, Name: "close"}
+
 type Handler struct {
-	app             *application.Application
-	id              string
-	module          string
-	subModule       string
-	name            string
-	endType         endtype.EndType
-	businessChannel string
-	rpcServer       *ManagedRpc
-	logger          *zap.Logger
-	logCnf          *logger.Config
-	engin           *http.Http
-	docServer       *DocServer
-	regInfo         *regCenter.RegInfo            // actions
-	gateway         *impl.Gateway                 // current channel  gateway
-	gateways        map[string]*impl.Gateway      // businessChannel => gateway
-	watchGwRegInfos map[string]*regCenter.RegInfo // businessChannel => gateway
-	errs            []error
-	flbNum          int
-	actListeners    []func(manager *action.Manager)
-	running         bool
+	app              *application.Application
+	id               string
+	module           string
+	subModule        string
+	name             string
+	endType          endtype.EndType
+	businessChannel  string
+	rpcServer        *ManagedRpc
+	logger           *zap.Logger
+	logCnf           *logger.Config
+	engin            *http.Http
+	docServer        *DocServer
+	regInfo          *regCenter.RegInfo            // actions
+	gateway          *impl.Gateway                 // current channel  gateway
+	gateways         map[string]*impl.Gateway      // businessChannel => gateway
+	watchGwRegInfos  map[string]*regCenter.RegInfo // businessChannel => gateway
+	errs             []error
+	lb               *action.LbPolicy
+	actionLbs        map[codec.ActionId]*action.LbPolicy
+	instanceSlb      action.Slb
+	pinAfter         map[codec.ActionId]bool
+	ownActs          map[codec.ActionId]bool
+	lbMu             sync.RWMutex
+	actListeners     []func(manager *action.Manager)
+	running          bool
+	gwOptions        []impl.GatewayOption
+	conns            *conn.Registry
+	sessions         *session.Manager
+	closeRouted      bool
+	docKey           string
+	draining         atomic.Bool
+	drainGrace       time.Duration
+	drainTimeout     time.Duration
+	shutdownHooks    []func()
+	gwJoinListeners  []func(channel, host string)
+	gwLeaveListeners []func(channel, host string)
+	gwLsMu           sync.RWMutex
+	gwMu             sync.RWMutex
+	ready            atomic.Bool
+	regErr           atomic.Value
+	regLost          chan struct{}
+	regLossListeners []func(key string)
+	regRetry         time.Duration
+	regMaxRetry      time.Duration
+	regRefresh       time.Duration
+	regMeta          *action.RegMeta
+	deprecated       map[codec.ActionId]bool
+	canary           *action.Canary
+	canaryRouting    bool
+	forwardUnknown   bool
+	peers            *rpcclient.Manager
+	peerIdx          *peerIndex
 }
 
 func New(app *application.Application, rps *ManagedRpc, module, subModule, name string, et endtype.EndType, businessChannel string, o ...Option) *Handler {
@@ -57,6 +101,9 @@ func New(app *application.Application, rps *ManagedRpc, module, subModule, name
 		rpcServer:       rps,
 		gateways:        make(map[string]*impl.Gateway),
 		watchGwRegInfos: make(map[string]*regCenter.RegInfo),
+		drainTimeout:    DefaultDrainTimeout,
+		regRetry:        DefaultRegRetry,
+		regMaxRetry:     DefaultRegMaxRetry,
 	}
 	s.initLogger()
 	s.initRegInfo()
@@ -66,6 +113,7 @@ func New(app *application.Application, rps *ManagedRpc, module, subModule, name
 	s.watchGwRegInfos[businessChannel] = reg
 
 	with(s, o...)
+	s.rpcServer.Manager().GetManager(businessChannel).Use(s.closerMiddleware, s.lbMiddleware)
 	return s
 }
 
@@ -103,15 +151,18 @@ func (s *Handler) Run(failedCb func(error)) {
 		return
 	}
 	s.logger.Info("init start...")
+	s.initHealthRoute()
 	if s.docServer != nil {
 		s.logger.Debug("doc server enabled")
 		s.logger.Info("doc url=" + s.docServer.DocUrl())
 		s.logger.Info(utils.ToStr("doc server[", s.docServer.engine.Host(), "] start and serving..."))
-		s.docServer.SyncStart(security.RandAlpha(6), failedCb)
+		s.docKey = security.RandAlpha(6)
+		s.docServer.SyncStart(s.docKey, failedCb)
 		if s.app.Register() != nil {
 			if err := s.app.DoRegister(s.docServer.RegInfo(), func(msg string) {
 				s.logger.Debug(msg)
 			}); err != nil {
+				s.setRegErr(err)
 				failedCb(err)
 				return
 			}
@@ -119,6 +170,7 @@ func (s *Handler) Run(failedCb func(error)) {
 	}
 	s.logger.Debug("handler watch start")
 	if err := s.watch(s.app.Register()); err != nil {
+		s.setRegErr(err)
 		failedCb(err)
 		return
 	}
@@ -129,21 +181,32 @@ func (s *Handler) Run(failedCb func(error)) {
 	if s.app.Register() != nil {
 		s.logger.Debug("action register start")
 		if err := s.register(s.app.Register(), true); err != nil {
+			s.setRegErr(err)
 			failedCb(s.handlerError("register failed", err))
 		}
 		s.logger.Debug("action registered")
+		if err := s.keepAlive(s.app.Register()); err != nil {
+			failedCb(s.handlerError("registration watch failed", err))
+		}
+		if s.canaryRouting || s.forwardUnknown {
+			if err := s.watchPeers(s.app.Register()); err != nil {
+				failedCb(s.handlerError("peer watch failed", err))
+			}
+		}
 	}
 	s.logger.Info("initialized")
 	s.logger.Info(utils.ToStr("server[", s.rpcServer.Server().Host().String(), "] start and serving..."))
 	s.rpcServer.Server().Run(failedCb)
 	s.running = true
+	s.ready.Store(true)
+	s.syncHealth()
 }
 
-// Release resource
+// Release resource, drain first: unregister the actions, wait the grace period for the gateways to notice,
+// wait the in-flight actions until the drain timeout, run the shutdown hooks, and then stop the rpc and doc servers
 func (s *Handler) Release() {
-	if s.rpcServer != nil {
-		s.rpcServer.s.Release()
-	}
+	s.draining.Store(true)
+	s.syncHealth()
 	if s.app.Register() != nil {
 		if s.docServer != nil {
 			_ = s.app.DoUnregister(s.docServer.RegInfo(), func(msg string) {
@@ -154,11 +217,58 @@ func (s *Handler) Release() {
 		}
 		_ = s.register(s.app.Register(), false)
 	}
+	if s.running && s.drainGrace > 0 {
+		s.logger.Info(utils.ToStr("draining, wait ", s.drainGrace.String(), " for the gateways"))
+		time.Sleep(s.drainGrace)
+	}
+	if !s.waitInflight(s.drainTimeout) {
+		s.logger.Warn(utils.ToStr("drain timeout, ", strconv.FormatInt(s.Inflight(), 10), " actions still in flight"))
+	}
+	for _, h := range s.shutdownHooks {
+		h()
+	}
+	if s.rpcServer != nil {
+		s.rpcServer.s.Release()
+	}
+	if s.docServer != nil && s.docKey != "" {
+		s.docServer.engine.CloseWithKey(s.docKey)
+	}
 	if s.logger != nil {
 		s.logger.Info("released")
 		_ = s.logger.Sync()
 	}
 	s.running = false
+	s.ready.Store(false)
+}
+
+// Draining return if the handler is releasing
+func (s *Handler) Draining() bool {
+	return s.draining.Load()
+}
+
+// Inflight return the count of the actions being handled by the rpc handler service, shared by the handlers of the same rpc server
+func (s *Handler) Inflight() int64 {
+	return s.rpcServer.Service().Inflight().Count()
+}
+
+// OnShutdown add a hook run after the in-flight actions drained and before the servers stopped
+func (s *Handler) OnShutdown(h func()) {
+	if h != nil {
+		s.shutdownHooks = append(s.shutdownHooks, h)
+	}
+}
+
+// waitInflight wait the in-flight actions done, return false when timeout, timeout <= 0 means no wait
+func (s *Handler) waitInflight(timeout time.Duration) bool {
+	if s.Inflight() == 0 {
+		return true
+	}
+	if timeout <= 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.rpcServer.Service().Inflight().Wait(ctx) == nil
 }
 
 func (s *Handler) Gateway() *impl.Gateway {
@@ -174,18 +284,34 @@ func (s *Handler) WssGateway() *impl.Gateway {
 }
 
 func (s *Handler) ChannelGateway(channel string) *impl.Gateway {
-	if v, ok := s.gateways[channel]; ok {
+	s.gwMu.RLock()
+	v, ok := s.gateways[channel]
+	s.gwMu.RUnlock()
+	if ok {
+		return v
+	}
+	s.gwMu.Lock()
+	defer s.gwMu.Unlock()
+	if v, ok = s.gateways[channel]; ok {
 		return v
 	}
 	gw, regInfo := s.initChannelGateway(channel)
 	s.gateways[channel] = gw
 	s.watchGwRegInfos[channel] = regInfo
-	_ = s.watchGw(s.app.Register(), gw, regInfo)
+	_ = s.watchGw(s.app.Register(), channel, gw, regInfo)
 	return gw
 }
 
+// AddrGateway return the gateway of the address channel, the current channel gateway is returned if the channel is empty
+func (s *Handler) AddrGateway(addr action.GatewayAddr) *impl.Gateway {
+	if addr.Channel == "" {
+		return s.gateway
+	}
+	return s.ChannelGateway(addr.Channel)
+}
+
 func (s *Handler) initChannelGateway(channel string) (*impl.Gateway, *regCenter.RegInfo) {
-	gw := impl.NewGateway(s.app.Context(), channel+"-"+s.module+"-"+s.subModule, rpcclient.NewManager())
+	gw := impl.NewGateway(s.app.Context(), channel+"-"+s.module+"-"+s.subModule, rpcclient.NewManager(), s.gwOptions...)
 	gw.Manager().RegisterAfterHandler(func(ctx context.Context, head rpcclient.Header, method string, req, reply interface{}, cc *grpc.ClientConn, err error, opts ...grpc.CallOption) {
 		if err != nil {
 			s.logger.Warn(utils.ToStr(head.RqId, " ", head.From, " rpc call ", head.To, " ", channel, "-gateway[", method, "] failed,", err.Error()), zap.Any("rq_id", head.RqId), zap.Any("req", req), zap.Any("resp", reply))
@@ -193,6 +319,14 @@ func (s *Handler) initChannelGateway(channel string) (*impl.Gateway, *regCenter.
 			s.logger.Debug(utils.ToStr(head.RqId, " ", head.From, " rpc call ", head.To, " ", channel, "-gateway[", method, "] success"), zap.Any("rq_id", head.RqId), zap.Any("req", req), zap.Any("resp", reply))
 		}
 	})
+	gw.With(impl.Channel(channel))
+	gw.With(impl.ReplyManager(s.rpcServer.Manager().GetManager(s.businessChannel)))
+	gw.With(impl.OnBreakerChange(func(host string, from, to impl.BreakerState) {
+		s.logger.Warn(utils.ToStr(gw.Id(), ": gateway [", host, "] circuit ", from.String(), " => ", to.String()), zap.String("host", host), zap.String("circuit", to.String()))
+	}))
+	gw.With(impl.OnOutboxError(func(id *bindv1.Id, err error) {
+		s.logger.Warn(utils.ToStr(gw.Id(), ": outbox of [", id.Typ, ":", id.Id, "] error, err=", err.Error()))
+	}))
 	regInfo := &regCenter.RegInfo{
 		AppId:   s.app.Cluster().Id(),
 		RegType: regtype.Rpc,
@@ -204,6 +338,56 @@ func (s *Handler) initChannelGateway(channel string) (*impl.Gateway, *regCenter.
 	return gw, regInfo
 }
 
+// routeCloseAction listen the close action once, so the gateways route the close action to the handler for the middlewares,
+// the close handler listened by the options or the app is kept
+func (s *Handler) routeCloseAction() {
+	if s.closeRouted {
+		return
+	}
+	s.closeRouted = true
+	s.actListeners = append(s.actListeners, func(manager *action.Manager) {
+		if _, _, _, ok := manager.GetHandler(closeAction.Id); ok {
+			return
+		}
+		manager.RegisterHandler(s.id, closeAction, func() codec.DataPtr { return nil }, func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+			return codec.Action{}, nil, nil
+		})
+	})
+}
+
+// closerMiddleware set the closer of the requests to close the connection by the gateway of the request channel,
+// and forget the pending messages and the slb of the connection after the close action routed by the options
+func (s *Handler) closerMiddleware(next action.Handler) action.Handler {
+	return func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+		if req.Action.Id == closeAction.Id {
+			gw := s.AddrGateway(req.GatewayAddr())
+			defer func() {
+				gw.DropPending(req.Gateway, req.Fd)
+				gw.DropSlb(req.Gateway, req.Fd)
+			}()
+		}
+		req.SetCloser(func(reason string) error {
+			return s.AddrGateway(req.GatewayAddr()).CloseAt(req.GatewayAddr(), req.Fd, reason)
+		})
+		return next(ctx, req)
+	}
+}
+
+// Sessions return the session manager, nil if not enabled by the Sessions option
+func (s *Handler) Sessions() *session.Manager {
+	return s.sessions
+}
+
+// Connections return the local connection registry, nil if not enabled by the ConnRegistry option
+func (s *Handler) Connections() *conn.Registry {
+	return s.conns
+}
+
+// ForwardStats return the forwarding counters of the rpc server handler service
+func (s *Handler) ForwardStats() impl.ForwardStats {
+	return s.rpcServer.Service().ForwardStats()
+}
+
 func (s *Handler) ActionManager() *impl.ManagerProvider {
 	return s.rpcServer.Manager()
 }
@@ -225,8 +409,9 @@ func (s *Handler) Engine() *http.Http {
 	return s.engin
 }
 
-// Listen action
-func (s *Handler) Listen(act codec.Action, structure action.DataStructure, handler action.Handler) {
+// Listen action, the requirements are checked before the handler called
+func (s *Handler) Listen(act codec.Action, structure action.DataStructure, handler action.Handler, requirements ...*action.Requirement) {
+	s.ownAction(act.Id)
 	s.actListeners = append(s.actListeners, func(manager *action.Manager) {
 		if _, _, _, ok := manager.GetHandler(act.Id); ok {
 			if act.Id != 0 {
@@ -234,10 +419,26 @@ func (s *Handler) Listen(act codec.Action, structure action.DataStructure, handl
 			}
 		}
 		manager.RegisterHandler(s.id, act, structure, handler)
+		manager.Require(act.Id, requirements...)
 		s.logger.Debug("listened action:" + act.Name)
 	})
 }
 
+// ListenReply listen the reply action of the gateway requests, seqOf return the sequence number of the reply data, nil if the reply carries none.
+// Only the replies routed to this instance are received, pin the connection to the instance by PinModuleToSelf when several instances serve the action
+func (s *Handler) ListenReply(act codec.Action, structure action.DataStructure, seqOf func(data codec.DataPtr) uint64) {
+	s.Listen(act, structure, func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+		var seq uint64
+		if seqOf != nil {
+			seq = seqOf(req.Data)
+		}
+		if !s.rpcServer.Manager().GetManager(s.businessChannel).Reply(action.ReplyKey(req.GatewayAddr().Host, req.Fd, act.Id, seq), req) {
+			s.logger.Debug(utils.ToStr("reply action:", act.Name, " not awaited, dropped"))
+		}
+		return codec.Action{}, nil, nil
+	})
+}
+
 func (s *Handler) docConfig(provider func() ([]byte, error), public bool) *DocConfig {
 	return &DocConfig{
 		id:       s.id,
@@ -276,28 +477,9 @@ func (s *Handler) handlerError(msg string, err error) error {
 	return utils.TitledError(utils.ToStr("handler[", s.name, "] error"), msg, err)
 }
 
-func (s *Handler) register(register regCenter.Register, reg bool) error {
-	return s.rpcServer.Manager().GetManager(s.businessChannel).RangeHandlerActions(s.id, func(act codec.Action) error {
-		prefix := s.regInfo.Prefix()
-		key := strings.TrimPrefix(strings.Join([]string{prefix, s.regInfo.ServerInfo.Id, s.regInfo.Host, act.Id.String()}, "/"), "/")
-		if reg {
-			val := act.Name
-			if s.flbNum > 0 {
-				val = val + "|" + strconv.Itoa(s.flbNum)
-			}
-			if err := register.Register(s.app.Context(), key, val, s.regInfo.Ttl); err != nil {
-				return err
-			}
-			s.logger.Debug(utils.ToStr("registered action:", key, "=>", val))
-		} else {
-			if err := register.Unregister(s.app.Context(), key); err != nil {
-				return err
-			}
-
-			s.logger.Debug(utils.ToStr("unregistered action:", key))
-		}
-		return nil
-	})
+// actionKeyPrefix return the registry key prefix of the handler actions
+func (s *Handler) actionKeyPrefix() string {
+	return strings.TrimPrefix(strings.Join([]string{s.regInfo.Prefix(), s.regInfo.ServerInfo.Id, s.regInfo.Host}, "/"), "/") + "/"
 }
 
 func (s *Handler) addErr(err error) {
@@ -310,43 +492,109 @@ func (s *Handler) watch(register regCenter.Register) error {
 	if register == nil {
 		return nil
 	}
+	s.gwMu.RLock()
+	defer s.gwMu.RUnlock()
 	for ch, gw := range s.gateways {
-		if err := s.watchGw(register, gw, s.watchGwRegInfos[ch]); err != nil {
+		if err := s.watchGw(register, ch, gw, s.watchGwRegInfos[ch]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *Handler) watchGw(register regCenter.Register, gw *impl.Gateway, regInfo *regCenter.RegInfo) error {
+func (s *Handler) watchGw(register regCenter.Register, channel string, gw *impl.Gateway, regInfo *regCenter.RegInfo) error {
 	prefix := regInfo.Prefix() + "/"
 	return register.Watch(s.app.Context(), prefix, func(key string, val string, isDel bool) {
 		segments := strings.Split(key, "/")
 		host := segments[len(segments)-1]
 		if isDel {
 			s.logger.Debug(utils.ToStr(gw.Id()+": gateway [", host, "] leaved"))
-			gw.Manager().Rm("gateway", host)
+			gw.RmHost(host)
+			if s.conns != nil {
+				closed := s.conns.RemoveGateway(host)
+				s.logger.Debug(utils.ToStr(gw.Id()+": gateway [", host, "] ", strconv.Itoa(len(closed)), " connections removed"))
+				s.closeConnections(channel, closed)
+			}
+			for _, l := range s.gatewayListeners(false) {
+				l(channel, host)
+			}
 		} else {
 			s.logger.Debug(utils.ToStr(gw.Id()+": gateway [", host, "] added"))
-			gw.Manager().Add("gateway", host)
+			gw.AddHost(host)
+			for _, l := range s.gatewayListeners(true) {
+				l(channel, host)
+			}
 		}
 	})
 }
 
+// closeConnections synthesize the close action for the connections of a leaved gateway, so the close handlers can clean up,
+// the channel of the connection is used, the watched channel only when the connection has none
+func (s *Handler) closeConnections(channel string, list []conn.Connection) {
+	m := s.rpcServer.Manager().GetManager(s.businessChannel)
+	_, _, handler, ok := m.GetHandler(closeAction.Id)
+	if !ok {
+		return
+	}
+	handler = m.Wrap(handler)
+	for _, c := range list {
+		target := c.Target
+		ch := c.Channel
+		if ch == "" {
+			ch = channel
+		}
+		req := action.NewHandlerReq(c.Gateway, closeAction, c.Fd, c.User, nil, c.BindIds, &target, codec.Proto, nil, action.Channel(ch))
+		if _, _, err := handler(s.app.Context(), req); err != nil {
+			s.logger.Warn(utils.ToStr("synthesized close of gateway[", c.Gateway, "] fd[", strconv.FormatInt(c.Fd, 10), "] failed, err=", err.Error()))
+		}
+	}
+}
+
+// OnGatewayJoin listen the gateway joining of the watched channels
+func (s *Handler) OnGatewayJoin(l func(channel, host string)) {
+	if l != nil {
+		s.gwLsMu.Lock()
+		s.gwJoinListeners = append(s.gwJoinListeners, l)
+		s.gwLsMu.Unlock()
+	}
+}
+
+// OnGatewayLeave listen the gateway leaving of the watched channels, the close action is synthesized for the tracked connections
+// of the gateway before the listeners called when the ConnRegistry option enabled
+func (s *Handler) OnGatewayLeave(l func(channel, host string)) {
+	if l != nil {
+		s.gwLsMu.Lock()
+		s.gwLeaveListeners = append(s.gwLeaveListeners, l)
+		s.gwLsMu.Unlock()
+	}
+}
+
+// gatewayListeners return a copy of the gateway join or leave listeners
+func (s *Handler) gatewayListeners(join bool) []func(channel, host string) {
+	s.gwLsMu.RLock()
+	defer s.gwLsMu.RUnlock()
+	if join {
+		return append([]func(channel, host string){}, s.gwJoinListeners...)
+	}
+	return append([]func(channel, host string){}, s.gwLeaveListeners...)
+}
+
 func (s *Handler) initLogger() {
 	s.logCnf = s.app.LogConfig()
 	s.logger = s.app.Logger().Named(utils.ToStr(s.id, "-", s.endType.String(), "-", s.businessChannel, "handler"))
 }
 
 // SetActionFlbNum 用于解决 action能负载到和同一个服务上去, 内部业务与外部业务使用相同的服务,(最好就是主服务的端口，都和主服务一样的轮训)
+// Deprecated: use SetLbPolicy with the pinned group
 func (s *Handler) SetActionFlbNum(num int) {
 	if num > 0 {
-		s.flbNum = num
+		s.SetLbPolicy(action.LbPolicy{Mode: action.LbPinned, Group: num})
 	}
 }
 
+// Deprecated: use SetLbPolicy with the pinned group, it only applies to the inner channel
 func (s *Handler) SetWssActionFlbNum(num int) {
-	if s.businessChannel == "inner" && num > 0 {
-		s.flbNum = num
+	if s.businessChannel == "inner" {
+		s.SetActionFlbNum(num)
 	}
 }
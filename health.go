@@ -0,0 +1,134 @@
+package sockethandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/obnahsgnaw/sockethandler/service/proto/impl"
+	"github.com/obnahsgnaw/socketutil/codec"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+)
+
+const (
+	RegistryDisabled = "disabled"
+	RegistryOk       = "ok"
+)
+
+// HealthStatus the health status of the handler
+type HealthStatus struct {
+	Id           string                       `json:"id"`
+	Ready        bool                         `json:"ready"`
+	Running      bool                         `json:"running"`
+	Draining     bool                         `json:"draining"`
+	Registry     string                       `json:"registry"`      // disabled, ok or the last registry error
+	Gateways     map[string]int               `json:"gateways"`      // channel => known gateway count, include the open circuits
+	OpenCircuits map[string]int               `json:"open_circuits"` // channel => gateway count with an open or half-open circuit
+	Circuits     map[string]impl.BreakerStats `json:"circuits"`      // channel => circuit breaker counters
+	Actions      int                          `json:"actions"`
+	Inflight     int64                        `json:"inflight"`
+}
+
+// Health return the health status of the handler
+func (s *Handler) Health() HealthStatus {
+	st := HealthStatus{
+		Id:           s.id,
+		Running:      s.ready.Load(),
+		Draining:     s.Draining(),
+		Registry:     s.registryStatus(),
+		Gateways:     make(map[string]int),
+		OpenCircuits: make(map[string]int),
+		Circuits:     make(map[string]impl.BreakerStats),
+		Inflight:     s.Inflight(),
+	}
+	s.gwMu.RLock()
+	for ch, gw := range s.gateways {
+		hosts := gw.AllHosts()
+		st.Gateways[ch] = len(hosts)
+		for _, host := range hosts {
+			if gw.BreakerState(host) != impl.BreakerClosed {
+				st.OpenCircuits[ch]++
+			}
+		}
+		st.Circuits[ch] = gw.BreakerStats()
+	}
+	s.gwMu.RUnlock()
+	_ = s.rpcServer.Manager().GetManager(s.businessChannel).RangeHandlerActions(s.id, func(act codec.Action) error {
+		st.Actions++
+		return nil
+	})
+	st.Ready = st.Running && !st.Draining && (st.Registry == RegistryOk || st.Registry == RegistryDisabled)
+	return st
+}
+
+// Ready return if the handler is serving the actions
+func (s *Handler) Ready() bool {
+	return s.Health().Ready
+}
+
+func (s *Handler) registryStatus() string {
+	if s.app.Register() == nil {
+		return RegistryDisabled
+	}
+	if err, _ := s.regErr.Load().(string); err != "" {
+		return err
+	}
+	return RegistryOk
+}
+
+// setRegErr record the registry error, nil clear it
+func (s *Handler) setRegErr(err error) {
+	if err != nil {
+		s.regErr.Store(err.Error())
+	} else {
+		s.regErr.Store("")
+	}
+	s.syncHealth()
+}
+
+// syncHealth sync the grpc serving status of the handler, the service name is the handler id
+func (s *Handler) syncHealth() {
+	h := s.rpcServer.Health()
+	if h == nil {
+		return
+	}
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if s.Ready() {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	h.SetServingStatus(s.id, status)
+}
+
+// initHealthRoute serve the /healthz and /readyz of the handler under the doc path, the root ones are not served
+// because the handlers sharing the engine can not report each other
+func (s *Handler) initHealthRoute() {
+	if s.engin == nil || s.docServer == nil {
+		return
+	}
+	e := s.engin.Engine()
+	served := make(map[string]bool)
+	for _, r := range e.Routes() {
+		served[r.Method+" "+r.Path] = true
+	}
+	live := func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.Health())
+	}
+	ready := func(c *gin.Context) {
+		st := s.Health()
+		code := http.StatusOK
+		if !st.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, st)
+	}
+	p := s.docServer.config.Doc.path
+	for _, r := range []struct {
+		path string
+		hd   gin.HandlerFunc
+	}{{p + "/healthz", live}, {p + "/readyz", ready}} {
+		if served[http.MethodGet+" "+r.path] {
+			s.logger.Warn("health route:" + r.path + " served by another handler, skipped")
+			continue
+		}
+		e.GET(r.path, r.hd)
+		s.logger.Debug("health route:" + r.path)
+	}
+}
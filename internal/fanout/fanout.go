@@ -0,0 +1,33 @@
+// Package fanout run the calls concurrently with a bounded concurrency
+package fanout
+
+import "sync"
+
+// Concurrency the max concurrent calls of a fan-out, shared by the gateway, the registry and the slb calls
+const Concurrency = 16
+
+// Run call fn for the indexes 0 to n-1 concurrently, at most Concurrency calls at the same time, return the last error
+func Run(n int, fn func(i int) error) (err error) {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, Concurrency)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err1 := fn(i); err1 != nil {
+				mu.Lock()
+				err = err1
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return
+}
@@ -0,0 +1,50 @@
+package fanout
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name string
+		n    int
+		fail int
+		want error
+	}{
+		{"none", 0, -1, nil},
+		{"all succeeded", 40, -1, nil},
+		{"one failed", 40, 7, errFailed},
+	}
+	for _, tt := range tests {
+		var calls, running, peak int32
+		err := Run(tt.n, func(i int) error {
+			atomic.AddInt32(&calls, 1)
+			cur := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if cur <= p || atomic.CompareAndSwapInt32(&peak, p, cur) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			if i == tt.fail {
+				return errFailed
+			}
+			return nil
+		})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Run() = %v, want %v", tt.name, err, tt.want)
+		}
+		if int(calls) != tt.n {
+			t.Errorf("%s: %d calls, want %d", tt.name, calls, tt.n)
+		}
+		if peak > Concurrency {
+			t.Errorf("%s: %d concurrent calls, want at most %d", tt.name, peak, Concurrency)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package filekv keep the values in json files of a dir, one file per key, the writes replace the file by a rename
+package filekv
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Dir the json files of the keys, the callers serialize the access
+type Dir struct {
+	dir string
+}
+
+// Open create the dir if not exist
+func Open(dir string) (*Dir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Dir{dir: dir}, nil
+}
+
+func (d *Dir) file(key string) string {
+	return filepath.Join(d.dir, hex.EncodeToString([]byte(key))+".json")
+}
+
+// Load decode the value of the key into v, return false if the key has no file
+func (d *Dir) Load(key string, v interface{}) (bool, error) {
+	b, err := os.ReadFile(d.file(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// Save write the value of the key
+func (d *Dir) Save(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := d.file(key) + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.file(key))
+}
+
+// Remove delete the file of the key, no error if not exist
+func (d *Dir) Remove(key string) error {
+	if err := os.Remove(d.file(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
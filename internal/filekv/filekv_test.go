@@ -0,0 +1,33 @@
+package filekv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	d, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if ok, err := d.Load("a/b", &got); ok || err != nil {
+		t.Fatalf("Load() of a missing key = %v, %v, want false, nil", ok, err)
+	}
+	want := map[string]string{"k": "v"}
+	if err = d.Save("a/b", want); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.Load("a/b", &got); !ok || err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Load() = %v, %v, %v, want %v", ok, err, got, want)
+	}
+	if err = d.Remove("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Remove("a/b"); err != nil {
+		t.Fatalf("Remove() of a missing key = %v, want nil", err)
+	}
+	if ok, _ := d.Load("a/b", &got); ok {
+		t.Error("Load() after Remove() found the key")
+	}
+}
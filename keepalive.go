@@ -0,0 +1,124 @@
+package sockethandler
+
+import (
+	"errors"
+	"github.com/obnahsgnaw/application/pkg/utils"
+	"github.com/obnahsgnaw/application/service/regCenter"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRegRetry the default first wait of the re-registration retries
+	DefaultRegRetry = time.Second
+	// DefaultRegMaxRetry the default max wait of the re-registration retries
+	DefaultRegMaxRetry = 30 * time.Second
+	// regLossDebounce wait the other keys of the same expired lease before re-registering
+	regLossDebounce = 500 * time.Millisecond
+)
+
+// ErrRegistrationLost the registered action keys are deleted from the registry, such as the lease expired
+var ErrRegistrationLost = errors.New("handler registration lost")
+
+// OnRegistrationLost listen the registration loss, key is the deleted action key, the actions are re-registered after the listeners called
+func (s *Handler) OnRegistrationLost(l func(key string)) {
+	if l != nil {
+		s.regLossListeners = append(s.regLossListeners, l)
+	}
+}
+
+// keepAlive watch the action keys of the handler, re-register the actions and the doc when the keys are deleted but not released,
+// and every refresh interval when RegRefresh set, because the registry has no lease or reconnect signal and the delete events
+// may be lost while the watch reconnecting
+func (s *Handler) keepAlive(register regCenter.Register) error {
+	s.regLost = make(chan struct{}, 1)
+	go s.reregisterLoop(register)
+	prefix := s.actionKeyPrefix()
+	return register.Watch(s.app.Context(), prefix, func(key string, val string, isDel bool) {
+		if !isDel || s.draining.Load() || !strings.HasPrefix(key, prefix) {
+			return
+		}
+		s.logger.Warn(utils.ToStr("registration lost:", key), zap.String("key", key))
+		for _, l := range s.regLossListeners {
+			l(key)
+		}
+		s.setRegErr(ErrRegistrationLost)
+		select {
+		case s.regLost <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// reregisterLoop re-register on the loss signals and the refresh ticks, retry with the backoff until succeeded, released or the context done
+func (s *Handler) reregisterLoop(register regCenter.Register) {
+	ctx := s.app.Context()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	var refresh <-chan time.Time
+	if s.regRefresh > 0 {
+		ticker := time.NewTicker(s.regRefresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+	var (
+		pending bool
+		attempt int
+		wait    = s.regRetry
+	)
+	schedule := func(d time.Duration) {
+		if !pending {
+			pending = true
+			timer.Reset(d)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.regLost:
+			// wait the other keys of the same loss
+			schedule(regLossDebounce)
+		case <-refresh:
+			schedule(0)
+		case <-timer.C:
+			pending = false
+			if s.draining.Load() {
+				return
+			}
+			attempt++
+			err := s.reregister(register)
+			if err == nil {
+				s.setRegErr(nil)
+				if attempt > 1 {
+					s.logger.Info(utils.ToStr("re-registered after ", strconv.Itoa(attempt), " attempts"))
+				} else {
+					s.logger.Debug("re-registered")
+				}
+				attempt, wait = 0, s.regRetry
+				continue
+			}
+			s.setRegErr(err)
+			s.logger.Warn(utils.ToStr("re-register failed, retry after ", wait.String(), ", err=", err.Error()))
+			schedule(wait)
+			if wait *= 2; wait > s.regMaxRetry {
+				wait = s.regMaxRetry
+			}
+		}
+	}
+}
+
+// reregister register the doc and the actions again, the keys written before a failure are kept for the retry
+func (s *Handler) reregister(register regCenter.Register) error {
+	if s.docServer != nil {
+		if err := s.app.DoRegister(s.docServer.RegInfo(), func(msg string) {
+			s.logger.Debug(msg)
+		}); err != nil {
+			return err
+		}
+	}
+	return s.writeActions(register, false)
+}
@@ -0,0 +1,144 @@
+package sockethandler
+
+import (
+	"context"
+	"errors"
+	"github.com/obnahsgnaw/application/pkg/utils"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+)
+
+// ErrNoInstanceSlb the slb of the instance is not set by the InstanceSlb option
+var ErrNoInstanceSlb = errors.New("handler instance slb not set")
+
+// SetLbPolicy set the default load balancing policy of the actions
+func (s *Handler) SetLbPolicy(p action.LbPolicy) {
+	s.lbMu.Lock()
+	s.lb = &p
+	s.lbMu.Unlock()
+	if p.Sticky() {
+		s.routeCloseAction()
+	}
+}
+
+// SetActionLbPolicy set the load balancing policy of the actions
+func (s *Handler) SetActionLbPolicy(p action.LbPolicy, ids ...codec.ActionId) {
+	s.lbMu.Lock()
+	if s.actionLbs == nil {
+		s.actionLbs = make(map[codec.ActionId]*action.LbPolicy)
+	}
+	for _, id := range ids {
+		s.actionLbs[id] = &p
+	}
+	s.lbMu.Unlock()
+	if p.Sticky() {
+		s.routeCloseAction()
+	}
+}
+
+// LbPolicy return the load balancing policy of the action listened by the handler, nil for the gateway default or the other actions
+func (s *Handler) LbPolicy(act codec.ActionId) *action.LbPolicy {
+	s.lbMu.RLock()
+	defer s.lbMu.RUnlock()
+	if !s.ownActs[act] {
+		return nil
+	}
+	if p, ok := s.actionLbs[act]; ok {
+		return p
+	}
+	return s.lb
+}
+
+// owns return if the action is listened by the handler
+func (s *Handler) owns(act codec.ActionId) bool {
+	s.lbMu.RLock()
+	defer s.lbMu.RUnlock()
+	return s.ownActs[act]
+}
+
+// ownAction record the action listened by the handler, the action manager of the channel is shared by the handlers
+func (s *Handler) ownAction(act codec.ActionId) {
+	s.lbMu.Lock()
+	defer s.lbMu.Unlock()
+	if s.ownActs == nil {
+		s.ownActs = make(map[codec.ActionId]bool)
+	}
+	s.ownActs[act] = true
+}
+
+// pinsAfter return if the module is pinned after the action listened by the handler
+func (s *Handler) pinsAfter(act codec.ActionId) bool {
+	s.lbMu.RLock()
+	defer s.lbMu.RUnlock()
+	return s.ownActs[act] && s.pinAfter[act]
+}
+
+// lbMiddleware set the slb of the sticky policies on the gateway once for the unpinned connection action, pin the module after the
+// PinModuleAfter actions, the slb calls run out of the request path, the actions of the other handlers sharing the manager are skipped
+func (s *Handler) lbMiddleware(next action.Handler) action.Handler {
+	return func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+		if req.Action.Id == closeAction.Id || !s.owns(req.Action.Id) {
+			return next(ctx, req)
+		}
+		addr := req.GatewayAddr()
+		gw := s.AddrGateway(addr)
+		if slb, ok := s.LbPolicy(req.Action.Id).Slb(req); ok {
+			if set := gw.StickActionSlbAt(addr, req.Fd, int64(req.Action.Id), slb); set != nil {
+				go func() {
+					if err := set(); err != nil {
+						s.logger.Warn(utils.ToStr("set action:", req.Action.Name, " slb failed, err=", err.Error()))
+					}
+				}()
+			}
+		}
+		respAct, respData, err := next(ctx, req)
+		if err == nil && s.pinsAfter(req.Action.Id) {
+			go func() {
+				if err1 := s.PinModuleToSelf(req); err1 != nil {
+					s.logger.Warn(utils.ToStr("pin module after action:", req.Action.Name, " failed, err=", err1.Error()))
+				}
+			}()
+		}
+		return respAct, respData, err
+	}
+}
+
+// PinModule pin all the actions of the handler on the request connection to the server selected by the slb
+func (s *Handler) PinModule(req *action.HandlerReq, slb action.Slb) error {
+	var acts []codec.ActionId
+	_ = s.rpcServer.Manager().GetManager(s.businessChannel).RangeHandlerActions(s.id, func(act codec.Action) error {
+		if act.Id != closeAction.Id {
+			acts = append(acts, act.Id)
+		}
+		return nil
+	})
+	addr := req.GatewayAddr()
+	return s.AddrGateway(addr).PinActionsAt(addr, req.Fd, slb, acts...)
+}
+
+// PinModuleToSelf pin all the actions of the handler on the request connection to this instance, such as after a stateful login
+func (s *Handler) PinModuleToSelf(req *action.HandlerReq) error {
+	if s.instanceSlb == action.SlbDefault {
+		return ErrNoInstanceSlb
+	}
+	return s.PinModule(req, s.instanceSlb)
+}
+
+// UnpinModule restore the gateway default load balancing of the request connection actions pinned by the handler
+func (s *Handler) UnpinModule(req *action.HandlerReq) error {
+	addr := req.GatewayAddr()
+	return s.AddrGateway(addr).UnpinActionsAt(addr, req.Fd)
+}
+
+// PinModuleAfter pin all the actions of the handler to this instance asynchronously after the actions handled successfully, such as the login action
+func (s *Handler) PinModuleAfter(ids ...codec.ActionId) {
+	s.lbMu.Lock()
+	if s.pinAfter == nil {
+		s.pinAfter = make(map[codec.ActionId]bool)
+	}
+	for _, id := range ids {
+		s.pinAfter[id] = true
+	}
+	s.lbMu.Unlock()
+	s.routeCloseAction()
+}
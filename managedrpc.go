@@ -9,11 +9,15 @@ import (
 	handlerv1 "github.com/obnahsgnaw/socketapi/gen/handler/v1"
 	"github.com/obnahsgnaw/sockethandler/service/action"
 	"github.com/obnahsgnaw/sockethandler/service/proto/impl"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type ManagedRpc struct {
 	s *rpc.Server
 	m *impl.ManagerProvider
+	h *health.Server
+	a *impl.HandlerService
 }
 
 func (s *ManagedRpc) Server() *rpc.Server {
@@ -24,32 +28,62 @@ func (s *ManagedRpc) Manager() *impl.ManagerProvider {
 	return s.m
 }
 
+// Service return the handler service
+func (s *ManagedRpc) Service() *impl.HandlerService {
+	return s.a
+}
+
+// Health return the grpc health server, the handlers set their serving status on it, nil if not enabled
+func (s *ManagedRpc) Health() *health.Server {
+	return s.h
+}
+
+// EnableHealth register the grpc health service on the server once, the server passed to InitRpc must not have one registered already
+func (s *ManagedRpc) EnableHealth() *health.Server {
+	if s.h == nil {
+		s.h = health.NewServer()
+		s.s.RegisterService(rpc.ServiceInfo{
+			Desc: healthpb.Health_ServiceDesc,
+			Impl: s.h,
+		})
+	}
+	return s.h
+}
+
+// InitRpc register the handler service on the server, the grpc health service is not registered, call EnableHealth to register it
 func InitRpc(s *rpc.Server) *ManagedRpc {
 	am := impl.NewManagerProvider(func() *action.Manager {
 		return action.NewManager()
 	})
+	a := impl.NewHandlerService(am)
 	s.RegisterService(rpc.ServiceInfo{
 		Desc: handlerv1.HandlerService_ServiceDesc,
-		Impl: impl.NewHandlerService(am),
+		Impl: a,
 	})
 	return &ManagedRpc{
 		s: s,
 		m: am,
+		a: a,
 	}
 }
 
+// NewRpc create the rpc server with the handler service and the grpc health service registered
 func NewRpc(app *application.Application, module, subModule string, et endtype.EndType, businessChannel string, lr *listener.PortedListener, p *rpc.PServer, o ...rpc.Option) *ManagedRpc {
 	id := module + "-" + subModule
 	s := rpc.New(app, lr, id, utils.ToStr(businessChannel, "-", id, "-rpc"), et, p, o...)
 	am := impl.NewManagerProvider(func() *action.Manager {
 		return action.NewManager()
 	})
+	a := impl.NewHandlerService(am)
 	s.RegisterService(rpc.ServiceInfo{
 		Desc: handlerv1.HandlerService_ServiceDesc,
-		Impl: impl.NewHandlerService(am),
+		Impl: a,
 	})
-	return &ManagedRpc{
+	m := &ManagedRpc{
 		s: s,
 		m: am,
+		a: a,
 	}
+	m.EnableHealth()
+	return m
 }
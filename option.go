@@ -1,7 +1,14 @@
 package sockethandler
 
 import (
+	"context"
 	"github.com/obnahsgnaw/http"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/conn"
+	"github.com/obnahsgnaw/sockethandler/service/proto/impl"
+	"github.com/obnahsgnaw/sockethandler/service/session"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"time"
 )
 
 type Option func(s *Handler)
@@ -34,3 +41,152 @@ func WatchChannelGateway(channel ...string) Option {
 		}
 	}
 }
+
+// GatewayOptions apply the options to all the channel gateways, such as the retry policies
+func GatewayOptions(o ...impl.GatewayOption) Option {
+	return func(s *Handler) {
+		s.gwOptions = append(s.gwOptions, o...)
+		for _, gw := range s.gateways {
+			gw.With(o...)
+		}
+	}
+}
+
+// ConnCloser set the closer of the gateway connections, the close action is routed to the handler to forget the closed connections
+func ConnCloser(c impl.Closer) Option {
+	return func(s *Handler) {
+		if c == nil {
+			return
+		}
+		GatewayOptions(impl.ConnCloser(c))(s)
+		s.routeCloseAction()
+	}
+}
+
+// DeliveryAck enable the at-least-once delivery, the ack action is listened to clear the pending messages of the acking connection,
+// the pending messages of the connection are dropped after the close action
+func DeliveryAck(cnf *impl.AckConfig) Option {
+	return func(s *Handler) {
+		if cnf == nil || cnf.AckSeq == nil {
+			return
+		}
+		GatewayOptions(impl.DeliveryAck(cnf))(s)
+		s.Listen(cnf.Action, cnf.Structure, func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+			s.AddrGateway(req.GatewayAddr()).Ack(req, cnf.AckSeq(req.Data))
+			return codec.Action{}, nil, nil
+		})
+		s.routeCloseAction()
+	}
+}
+
+// ConnRegistry enable the local connection registry, maintained from the handled requests, the bind calls and the close action
+func ConnRegistry() Option {
+	return func(s *Handler) {
+		if s.conns != nil {
+			return
+		}
+		s.conns = conn.NewRegistry()
+		GatewayOptions(impl.ConnRegistry(s.conns))(s)
+		s.rpcServer.Manager().GetManager(s.businessChannel).Use(s.conns.Middleware())
+		s.routeCloseAction()
+	}
+}
+
+// AuthPolicy set the global policy checked for every action after the action requirements
+func AuthPolicy(p action.Policy) Option {
+	return func(s *Handler) {
+		s.rpcServer.Manager().GetManager(s.businessChannel).SetPolicy(p)
+	}
+}
+
+// UserAttrs register the expected user attributes, the requests with invalid attributes are rejected when reject is true
+func UserAttrs(reject bool, specs ...action.AttrSpec) Option {
+	return func(s *Handler) {
+		m := s.rpcServer.Manager().GetManager(s.businessChannel)
+		m.RegisterAttr(specs...)
+		m.RejectInvalidAttr(reject)
+	}
+}
+
+// Sessions enable the connection sessions of the store, the connection session is cleared after the close action handled
+func Sessions(store session.Store) Option {
+	return func(s *Handler) {
+		if store == nil || s.sessions != nil {
+			return
+		}
+		s.sessions = session.NewManager(store)
+		s.rpcServer.Manager().GetManager(s.businessChannel).Use(func(next action.Handler) action.Handler {
+			return func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+				req.SetSession(s.sessions)
+				if req.Action.Id == closeAction.Id {
+					defer func() {
+						_ = req.Session().Clear()
+					}()
+				}
+				return next(ctx, req)
+			}
+		})
+		s.routeCloseAction()
+	}
+}
+
+// Drain set the grace period waiting for the gateways to notice the unregistered actions and the max wait of the in-flight actions when releasing
+func Drain(grace, timeout time.Duration) Option {
+	return func(s *Handler) {
+		s.drainGrace = grace
+		s.drainTimeout = timeout
+	}
+}
+
+// RegRefresh re-register the actions and the doc every interval, recover the registration lost without a delete event
+// such as the events missed while the watch reconnecting, 0 disable it
+func RegRefresh(interval time.Duration) Option {
+	return func(s *Handler) {
+		s.regRefresh = interval
+	}
+}
+
+// RegRetry set the first and the max wait of the re-registration retries after the registration lost
+func RegRetry(retry, max time.Duration) Option {
+	return func(s *Handler) {
+		if retry > 0 {
+			s.regRetry = retry
+		}
+		if max >= s.regRetry {
+			s.regMaxRetry = max
+		}
+	}
+}
+
+// ActionMeta register the actions with the json metadata of the handler version, the load balancing weight and the supported codecs,
+// the deprecated flag and the auth requirements are filled per action, the gateways must parse it by action.ParseRegMeta
+func ActionMeta(version string, weight int, codecs ...codec.Name) Option {
+	return func(s *Handler) {
+		s.regMeta = &action.RegMeta{Version: version, Weight: weight, Codecs: codecs}
+	}
+}
+
+// CanaryRouting enable the canary routing, c is the canary rule of the instance, nil for the stable instances,
+// the requests are forwarded between the instances by the canary rules registered under the canary key of the instance,
+// the action values keep their format so the legacy gateways are not affected
+func CanaryRouting(c *action.Canary) Option {
+	return func(s *Handler) {
+		s.canaryRouting = true
+		s.canary = c
+	}
+}
+
+// ForwardUnknown forward the requests of the actions not served locally to the handlers registered them,
+// the forwarded requests are not forwarded again
+func ForwardUnknown() Option {
+	return func(s *Handler) {
+		s.forwardUnknown = true
+	}
+}
+
+// InstanceSlb set the slb the gateway resolves to this instance, the actions pinned with it go to this instance
+func InstanceSlb(slb action.Slb) Option {
+	return func(s *Handler) {
+		s.instanceSlb = slb
+	}
+}
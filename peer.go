@@ -0,0 +1,224 @@
+package sockethandler
+
+import (
+	"context"
+	"github.com/obnahsgnaw/application/pkg/utils"
+	"github.com/obnahsgnaw/application/service/regCenter"
+	"github.com/obnahsgnaw/rpc/pkg/rpcclient"
+	handlerv1 "github.com/obnahsgnaw/socketapi/gen/handler/v1"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/proto/impl"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"google.golang.org/grpc"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// peerIndex the registered actions and canary rules of the other handler instances of the channel
+type peerIndex struct {
+	sync.RWMutex
+	actions  map[codec.ActionId]map[string]action.RegMeta // action => host => meta
+	canaries map[string]*action.Canary                    // host => canary rule, absent for the stable instances
+}
+
+func newPeerIndex() *peerIndex {
+	return &peerIndex{actions: make(map[codec.ActionId]map[string]action.RegMeta), canaries: make(map[string]*action.Canary)}
+}
+
+func (p *peerIndex) setCanary(host string, c *action.Canary) {
+	p.Lock()
+	defer p.Unlock()
+	if c == nil {
+		delete(p.canaries, host)
+		return
+	}
+	p.canaries[host] = c
+}
+
+func (p *peerIndex) canary(host string) *action.Canary {
+	p.RLock()
+	defer p.RUnlock()
+	return p.canaries[host]
+}
+
+func (p *peerIndex) set(act codec.ActionId, host string, meta action.RegMeta) {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.actions[act]; !ok {
+		p.actions[act] = make(map[string]action.RegMeta)
+	}
+	p.actions[act][host] = meta
+}
+
+func (p *peerIndex) del(act codec.ActionId, host string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.actions[act], host)
+	if len(p.actions[act]) == 0 {
+		delete(p.actions, act)
+	}
+}
+
+func (p *peerIndex) hosts(act codec.ActionId) map[string]action.RegMeta {
+	p.RLock()
+	defer p.RUnlock()
+	list := make(map[string]action.RegMeta, len(p.actions[act]))
+	for h, m := range p.actions[act] {
+		list[h] = m
+	}
+	return list
+}
+
+// watchPeers watch the action keys of the channel, the keys are prefix/server-id/host/action-id
+func (s *Handler) watchPeers(register regCenter.Register) error {
+	if s.peerIdx != nil {
+		return nil
+	}
+	s.peerIdx = newPeerIndex()
+	s.peers = rpcclient.NewManager()
+	s.rpcServer.Service().Forward(s.businessChannel, s.forward)
+	if s.canaryRouting {
+		if err := s.watchCanaries(register); err != nil {
+			return err
+		}
+	}
+	return register.Watch(s.app.Context(), strings.TrimPrefix(s.regInfo.Prefix()+"/", "/"), func(key string, val string, isDel bool) {
+		segments := strings.Split(key, "/")
+		if len(segments) < 3 {
+			return
+		}
+		id, err := strconv.ParseUint(segments[len(segments)-1], 10, 32)
+		host := segments[len(segments)-2]
+		if err != nil || host == s.regInfo.Host {
+			return
+		}
+		if isDel {
+			s.peerIdx.del(codec.ActionId(id), host)
+			return
+		}
+		meta, err := action.ParseRegMeta(val)
+		if err != nil {
+			s.logger.Warn(utils.ToStr("peer action:", key, " metadata invalid, err=", err.Error()))
+			return
+		}
+		s.peerIdx.set(codec.ActionId(id), host, meta)
+	})
+}
+
+// watchCanaries watch the canary rules of the channel instances
+func (s *Handler) watchCanaries(register regCenter.Register) error {
+	prefix := s.canaryKeyPrefix()
+	return register.Watch(s.app.Context(), prefix, func(key string, val string, isDel bool) {
+		host := strings.TrimPrefix(key, prefix)
+		if host == "" || strings.Contains(host, "/") || host == s.regInfo.Host {
+			return
+		}
+		if isDel {
+			s.peerIdx.setCanary(host, nil)
+			return
+		}
+		c, err := action.ParseCanary(val)
+		if err != nil {
+			s.logger.Warn(utils.ToStr("peer canary:", key, " invalid, err=", err.Error()))
+			return
+		}
+		s.peerIdx.setCanary(host, c)
+	})
+}
+
+// forward forward the request not served locally to the owner, the canary request to the matched peer,
+// the canary request is handled locally when no peer matched or the forwarding failed
+func (s *Handler) forward(ctx context.Context, q *handlerv1.HandleRequest) (*handlerv1.HandleResponse, bool, error) {
+	if host, ok := s.ownerHost(q); ok {
+		resp, err := s.forwardTo(ctx, host, q)
+		if err != nil {
+			s.logger.Warn(utils.ToStr("forward action:", strconv.FormatUint(uint64(q.ActionId), 10), " to owner [", host, "] failed, err=", err.Error()))
+		}
+		return resp, true, err
+	}
+	host, ok := s.canaryHost(q)
+	if !ok {
+		return nil, false, nil
+	}
+	resp, err := s.forwardTo(ctx, host, q)
+	if err != nil {
+		s.logger.Warn(utils.ToStr("forward action:", strconv.FormatUint(uint64(q.ActionId), 10), " to [", host, "] failed, handle locally, err=", err.Error()))
+		return nil, false, nil
+	}
+	return resp, true, nil
+}
+
+func (s *Handler) forwardTo(ctx context.Context, host string, q *handlerv1.HandleRequest) (resp *handlerv1.HandleResponse, err error) {
+	err = s.peers.HostCall(ctx, host, 0, s.id, "handler", "", "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+		var err1 error
+		resp, err1 = impl.ForwardTo(ctx, cc, s.regInfo.Host, q)
+		return err1
+	})
+	return
+}
+
+// ownerHost return the peer serving the action not served locally, the same routing key goes to the same peer
+func (s *Handler) ownerHost(q *handlerv1.HandleRequest) (string, bool) {
+	if !s.forwardUnknown {
+		return "", false
+	}
+	if _, _, _, ok := s.rpcServer.Manager().GetManager(q.BusinessChannel).GetHandler(codec.ActionId(q.ActionId)); ok {
+		return "", false
+	}
+	var candidates []string
+	for host := range s.peerIdx.hosts(codec.ActionId(q.ActionId)) {
+		candidates = append(candidates, host)
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	_, _, key := routeKey(q)
+	sort.Strings(candidates)
+	return candidates[action.KeyHash(key)%uint32(len(candidates))], true
+}
+
+// routeKey return the user id, the target type and the routing key of the request
+func routeKey(q *handlerv1.HandleRequest) (uid uint32, typ, key string) {
+	if q.User != nil {
+		uid = uint32(q.User.Id)
+	}
+	if q.Target != nil {
+		typ = q.Target.Type
+		if id := utils.ToStr(q.Target.Sn, q.Target.Id); id != "" {
+			key = typ + ":" + id
+		}
+	}
+	if key == "" && uid > 0 {
+		key = "user:" + strconv.FormatUint(uint64(uid), 10)
+	}
+	if key == "" {
+		key = q.Gateway + "#" + strconv.FormatInt(q.Fd, 10)
+	}
+	return
+}
+
+// canaryHost return the peer the request should be routed to, the canary instance routes the unmatched requests to the stable peers,
+// the stable instance routes the requests matching the canary peers to them, the same routing key goes to the same peer
+func (s *Handler) canaryHost(q *handlerv1.HandleRequest) (string, bool) {
+	if !s.canaryRouting {
+		return "", false
+	}
+	uid, typ, key := routeKey(q)
+	if s.canary.Match(uid, typ, key) {
+		return "", false
+	}
+	var candidates []string
+	for host := range s.peerIdx.hosts(codec.ActionId(q.ActionId)) {
+		c := s.peerIdx.canary(host)
+		if (s.canary != nil && c == nil) || (s.canary == nil && c.Match(uid, typ, key)) {
+			candidates = append(candidates, host)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	sort.Strings(candidates)
+	return candidates[action.KeyHash(key)%uint32(len(candidates))], true
+}
@@ -0,0 +1,135 @@
+package sockethandler
+
+import (
+	"github.com/obnahsgnaw/application/pkg/utils"
+	"github.com/obnahsgnaw/application/service/regCenter"
+	"github.com/obnahsgnaw/sockethandler/internal/fanout"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"strconv"
+	"strings"
+)
+
+// ActionMeta return the registration metadata of the action
+func (s *Handler) ActionMeta(act codec.Action) action.RegMeta {
+	meta := action.RegMeta{Name: act.Name, Lb: s.LbPolicy(act.Id)}
+	if meta.Lb != nil && meta.Lb.Mode == action.LbPinned {
+		meta.Flb = meta.Lb.Group
+	}
+	if s.regMeta != nil {
+		meta.Version = s.regMeta.Version
+		meta.Weight = s.regMeta.Weight
+		meta.Codecs = s.regMeta.Codecs
+	}
+	meta.Deprecated = s.deprecated[act.Id]
+	s.rpcServer.Manager().GetManager(s.businessChannel).Meta(act.Id, &meta)
+	return meta
+}
+
+// Deprecate mark the actions deprecated in the registration metadata
+func (s *Handler) Deprecate(ids ...codec.ActionId) {
+	if s.deprecated == nil {
+		s.deprecated = make(map[codec.ActionId]bool)
+	}
+	for _, id := range ids {
+		s.deprecated[id] = true
+	}
+}
+
+// actionValue return the registry value of the action, the json metadata if enabled by the ActionMeta option, otherwise the legacy name|flb
+func (s *Handler) actionValue(act codec.Action) string {
+	meta := s.ActionMeta(act)
+	if s.regMeta == nil {
+		return meta.Legacy()
+	}
+	return meta.Encode()
+}
+
+// actionKvs return the registry keys and values of the handler actions, and the canary rule of the canary instance
+func (s *Handler) actionKvs() map[string]string {
+	kvs := make(map[string]string)
+	_ = s.rpcServer.Manager().GetManager(s.businessChannel).RangeHandlerActions(s.id, func(act codec.Action) error {
+		kvs[s.actionKeyPrefix()+act.Id.String()] = s.actionValue(act)
+		return nil
+	})
+	if len(kvs) > 0 && s.canaryRouting && s.canary != nil {
+		kvs[s.canaryKeyPrefix()+s.regInfo.Host] = s.canary.Encode()
+	}
+	return kvs
+}
+
+// canaryKeyPrefix return the registry key prefix of the canary rules of the channel instances, the keys are
+// canary/prefix/host, out of the action key prefix watched by the gateways
+func (s *Handler) canaryKeyPrefix() string {
+	return "canary/" + strings.TrimPrefix(s.regInfo.Prefix()+"/", "/")
+}
+
+// register register or unregister all the actions, the written keys are rolled back when the registering failed,
+// the unregistering goes on after failures and returns the last error
+func (s *Handler) register(register regCenter.Register, reg bool) error {
+	if reg {
+		return s.writeActions(register, true)
+	}
+	kvs := s.actionKvs()
+	if len(kvs) == 0 {
+		return nil
+	}
+	ctx := s.app.Context()
+	_, err := s.rangeKvs(kvs, func(key, val string) error {
+		if err := register.Unregister(ctx, key); err != nil {
+			return err
+		}
+		s.logger.Debug(utils.ToStr("unregistered action:", key))
+		return nil
+	})
+	return err
+}
+
+// writeActions write all the action keys, the written keys are rolled back on failure only when rollback is true,
+// the re-registration does not roll back because the written keys may be the healthy ones registered before
+func (s *Handler) writeActions(register regCenter.Register, rollback bool) error {
+	kvs := s.actionKvs()
+	if len(kvs) == 0 {
+		return nil
+	}
+	ctx := s.app.Context()
+	written, err := s.rangeKvs(kvs, func(key, val string) error {
+		if err := register.Register(ctx, key, val, s.regInfo.Ttl); err != nil {
+			return err
+		}
+		s.logger.Debug(utils.ToStr("registered action:", key, "=>", val))
+		return nil
+	})
+	if err != nil && rollback {
+		for _, key := range written {
+			if err1 := register.Unregister(ctx, key); err1 != nil {
+				s.logger.Warn(utils.ToStr("rollback action:", key, " failed, err=", err1.Error()))
+			}
+		}
+		s.logger.Debug(utils.ToStr("register failed, ", strconv.Itoa(len(written)), " actions rolled back"))
+	}
+	return err
+}
+
+// rangeKvs call the handler concurrently, return the succeeded keys and the last error
+func (s *Handler) rangeKvs(kvs map[string]string, handler func(key, val string) error) ([]string, error) {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	ok := make([]bool, len(keys))
+	err := fanout.Run(len(keys), func(i int) error {
+		if err := handler(keys[i], kvs[keys[i]]); err != nil {
+			return err
+		}
+		ok[i] = true
+		return nil
+	})
+	done := make([]string, 0, len(keys))
+	for i, k := range keys {
+		if ok[i] {
+			done = append(done, k)
+		}
+	}
+	return done, err
+}
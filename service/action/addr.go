@@ -0,0 +1,46 @@
+package action
+
+import "strings"
+
+// rqIdSeparator separates the request id and the host in the encoded gateway string: "<rqId>:@<host>"
+const rqIdSeparator = ":@"
+
+// GatewayAddr the gateway address of a connection, with the request id and the business channel it came from
+type GatewayAddr struct {
+	Host    string
+	RqId    string
+	Channel string
+}
+
+// ParseGatewayAddr parse the gateway string, the string may be a plain host or the encoded "<rqId>:@<host>" form
+func ParseGatewayAddr(gw string) GatewayAddr {
+	if i := strings.Index(gw, rqIdSeparator); i >= 0 {
+		return GatewayAddr{Host: gw[i+len(rqIdSeparator):], RqId: gw[:i]}
+	}
+	return GatewayAddr{Host: gw}
+}
+
+// FormatGatewayAddr format the host and request id to the encoded gateway string
+func FormatGatewayAddr(host, rqId string) string {
+	if rqId == "" {
+		return host
+	}
+	return rqId + rqIdSeparator + host
+}
+
+// String return the encoded gateway string, the channel is not encoded
+func (a GatewayAddr) String() string {
+	return FormatGatewayAddr(a.Host, a.RqId)
+}
+
+// WithChannel return a copy of the address with the business channel
+func (a GatewayAddr) WithChannel(channel string) GatewayAddr {
+	a.Channel = channel
+	return a
+}
+
+// WithRqId return a copy of the address with the request id
+func (a GatewayAddr) WithRqId(rqId string) GatewayAddr {
+	a.RqId = rqId
+	return a
+}
@@ -0,0 +1,45 @@
+package action
+
+import "testing"
+
+func TestParseGatewayAddr(t *testing.T) {
+	cases := []struct {
+		name string
+		gw   string
+		want GatewayAddr
+	}{
+		{"plain host", "127.0.0.1:8001", GatewayAddr{Host: "127.0.0.1:8001"}},
+		{"encoded", "rq1:@127.0.0.1:8001", GatewayAddr{Host: "127.0.0.1:8001", RqId: "rq1"}},
+		{"host with @", "rq1:@user@gw.local:8001", GatewayAddr{Host: "user@gw.local:8001", RqId: "rq1"}},
+		{"host with separator", "rq1:@gw:@8001", GatewayAddr{Host: "gw:@8001", RqId: "rq1"}},
+		{"empty request id", ":@127.0.0.1:8001", GatewayAddr{Host: "127.0.0.1:8001"}},
+		{"empty", "", GatewayAddr{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ParseGatewayAddr(c.gw); got != c.want {
+				t.Errorf("ParseGatewayAddr(%q) = %+v, want %+v", c.gw, got, c.want)
+			}
+		})
+	}
+}
+
+func TestGatewayAddrString(t *testing.T) {
+	cases := []struct {
+		addr GatewayAddr
+		want string
+	}{
+		{GatewayAddr{Host: "127.0.0.1:8001"}, "127.0.0.1:8001"},
+		{GatewayAddr{Host: "127.0.0.1:8001", RqId: "rq1"}, "rq1:@127.0.0.1:8001"},
+		{GatewayAddr{Host: "user@gw.local:8001", RqId: "rq1", Channel: "inner"}, "rq1:@user@gw.local:8001"},
+	}
+	for _, c := range cases {
+		got := c.addr.String()
+		if got != c.want {
+			t.Errorf("%+v.String() = %q, want %q", c.addr, got, c.want)
+		}
+		if back := ParseGatewayAddr(got); back.Host != c.addr.Host || back.RqId != c.addr.RqId {
+			t.Errorf("ParseGatewayAddr(%q) = %+v, not round trip", got, back)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttrTag the struct tag of the attribute name used by User.Decode
+const AttrTag = "attr"
+
+// ErrAttrMissing the required attribute is missing
+var ErrAttrMissing = errors.New("user attribute missing")
+
+// AttrError the attribute parse error
+type AttrError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *AttrError) Error() string {
+	return "user attribute[" + e.Key + "=" + e.Value + "] invalid, err=" + e.Err.Error()
+}
+
+func (e *AttrError) Unwrap() error {
+	return e.Err
+}
+
+func (s *User) attr(key string) (string, bool) {
+	if s == nil || s.Attr == nil {
+		return "", false
+	}
+	v, ok := s.Attr[key]
+	return v, ok
+}
+
+// Int return the int attribute, ok is false when missing, err is not nil when not an int
+func (s *User) Int(key string) (int, bool, error) {
+	v, ok := s.attr(key)
+	if !ok {
+		return 0, false, nil
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, true, &AttrError{Key: key, Value: v, Err: err}
+	}
+	return i, true, nil
+}
+
+// Uint32 return the uint32 attribute, ok is false when missing, err is not nil when not an uint32
+func (s *User) Uint32(key string) (uint32, bool, error) {
+	v, ok := s.attr(key)
+	if !ok {
+		return 0, false, nil
+	}
+	i, err := strconv.ParseUint(strings.TrimSpace(v), 10, 32)
+	if err != nil {
+		return 0, true, &AttrError{Key: key, Value: v, Err: err}
+	}
+	return uint32(i), true, nil
+}
+
+// Bool return the bool attribute, ok is false when missing, err is not nil when not a bool
+func (s *User) Bool(key string) (bool, bool, error) {
+	v, ok := s.attr(key)
+	if !ok {
+		return false, false, nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return false, true, &AttrError{Key: key, Value: v, Err: err}
+	}
+	return b, true, nil
+}
+
+// Time return the time attribute of RFC3339, "2006-01-02 15:04:05" in local or unix seconds,
+// ok is false when missing, err is not nil when not a time
+func (s *User) Time(key string) (time.Time, bool, error) {
+	v, ok := s.attr(key)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	v = strings.TrimSpace(v)
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", v, time.Local); err == nil {
+		return t, true, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, true, &AttrError{Key: key, Value: v, Err: errors.New("not a time")}
+	}
+	return time.Unix(sec, 0), true, nil
+}
+
+// Strings return the comma separated attribute, ok is false when missing
+func (s *User) Strings(key string) ([]string, bool, error) {
+	v, ok := s.attr(key)
+	if !ok {
+		return nil, false, nil
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, true, nil
+}
+
+type AttrType int
+
+const (
+	AttrString AttrType = iota
+	AttrInt
+	AttrUint32
+	AttrBool
+	AttrTime
+	AttrStrings
+)
+
+// AttrSpec the spec of an expected attribute
+type AttrSpec struct {
+	Key      string
+	Type     AttrType
+	Required bool
+}
+
+// attrSchema the expected attributes of the manager
+type attrSchema struct {
+	sync.RWMutex
+	specs  []AttrSpec
+	reject bool
+}
+
+// RegisterAttr register the expected attributes of the users of the manager actions
+func (m *Manager) RegisterAttr(specs ...AttrSpec) {
+	m.attrs.Lock()
+	defer m.attrs.Unlock()
+	m.attrs.specs = append(m.attrs.specs, specs...)
+}
+
+// RejectInvalidAttr reject the requests of which the user attributes are invalid against the registered attributes, default not rejected
+func (m *Manager) RejectInvalidAttr(reject bool) {
+	m.attrs.Lock()
+	defer m.attrs.Unlock()
+	m.attrs.reject = reject
+}
+
+// AttrSpecs return the registered attributes
+func (m *Manager) AttrSpecs() []AttrSpec {
+	m.attrs.RLock()
+	defer m.attrs.RUnlock()
+	return append([]AttrSpec(nil), m.attrs.specs...)
+}
+
+// CheckAttr validate the request user against the registered attributes when the rejection enabled,
+// the close action and the requests without a user are not checked
+func (m *Manager) CheckAttr(req *HandlerReq) error {
+	if req.User == nil || req.Action.Id == m.closeAction.Id {
+		return nil
+	}
+	m.attrs.RLock()
+	reject := m.attrs.reject
+	m.attrs.RUnlock()
+	if !reject {
+		return nil
+	}
+	return req.User.Validate(m.AttrSpecs()...)
+}
+
+// Validate validate the attributes against the specs
+func (s *User) Validate(specs ...AttrSpec) (err error) {
+	for _, spec := range specs {
+		var ok bool
+		switch spec.Type {
+		case AttrInt:
+			_, ok, err = s.Int(spec.Key)
+		case AttrUint32:
+			_, ok, err = s.Uint32(spec.Key)
+		case AttrBool:
+			_, ok, err = s.Bool(spec.Key)
+		case AttrTime:
+			_, ok, err = s.Time(spec.Key)
+		default:
+			_, ok = s.attr(spec.Key)
+		}
+		if err != nil {
+			return
+		}
+		if !ok && spec.Required {
+			return fmt.Errorf("%w: %s", ErrAttrMissing, spec.Key)
+		}
+	}
+	return
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	stringsType = reflect.TypeOf([]string(nil))
+)
+
+// Decode decode the attributes into the struct pointer by the attr tags, such as `attr:"company_id"`,
+// the fields without the tag or with the missing attributes are kept
+func (s *User) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("user attribute decode target must be a struct pointer")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		key := rt.Field(i).Tag.Get(AttrTag)
+		if key == "" || key == "-" {
+			continue
+		}
+		if err := s.decodeField(key, rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *User) decodeField(key string, f reflect.Value) error {
+	raw, ok := s.attr(key)
+	if !ok || !f.CanSet() {
+		return nil
+	}
+	if f.Type() == timeType {
+		t, _, err := s.Time(key)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	raw = strings.TrimSpace(raw)
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return &AttrError{Key: key, Value: raw, Err: err}
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, f.Type().Bits())
+		if err != nil {
+			return &AttrError{Key: key, Value: raw, Err: err}
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(raw, 10, f.Type().Bits())
+		if err != nil {
+			return &AttrError{Key: key, Value: raw, Err: err}
+		}
+		f.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		fv, err := strconv.ParseFloat(raw, f.Type().Bits())
+		if err != nil {
+			return &AttrError{Key: key, Value: raw, Err: err}
+		}
+		f.SetFloat(fv)
+	case reflect.Slice:
+		if f.Type() != stringsType {
+			return &AttrError{Key: key, Value: raw, Err: errors.New("unsupported field type " + f.Type().String())}
+		}
+		list, _, _ := s.Strings(key)
+		f.Set(reflect.ValueOf(list))
+	default:
+		return &AttrError{Key: key, Value: raw, Err: errors.New("unsupported field type " + f.Type().String())}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package action
+
+import (
+	"errors"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type decodeTarget struct {
+	Cid     uint32    `attr:"company_id"`
+	Name    string    `attr:"name"`
+	Admin   bool      `attr:"admin"`
+	Level   int8      `attr:"level"`
+	Rate    float64   `attr:"rate"`
+	Roles   []string  `attr:"roles"`
+	Expires time.Time `attr:"expires"`
+	Skipped string    `attr:"-"`
+	Untag   string
+}
+
+func TestUserDecode(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		attr  map[string]string
+		want  decodeTarget
+		isErr bool
+	}{
+		{"empty", nil, decodeTarget{}, false},
+		{"all", map[string]string{
+			"company_id": " 5 ", "name": "n", "admin": "true", "level": "-3", "rate": "0.5",
+			"roles": "a, b,,c", "expires": at.Format(time.RFC3339), "Skipped": "x", "Untag": "x",
+		}, decodeTarget{Cid: 5, Name: "n", Admin: true, Level: -3, Rate: 0.5, Roles: []string{"a", "b", "c"}, Expires: at}, false},
+		{"unix time", map[string]string{"expires": strconv.FormatInt(at.Unix(), 10)}, decodeTarget{Expires: time.Unix(at.Unix(), 0)}, false},
+		{"invalid uint", map[string]string{"company_id": "-1"}, decodeTarget{}, true},
+		{"int overflow", map[string]string{"level": "300"}, decodeTarget{}, true},
+		{"invalid bool", map[string]string{"admin": "maybe"}, decodeTarget{}, true},
+		{"invalid time", map[string]string{"expires": "tomorrow"}, decodeTarget{}, true},
+	}
+	for _, tt := range tests {
+		var got decodeTarget
+		err := (&User{Attr: tt.attr}).Decode(&got)
+		if tt.isErr {
+			var ae *AttrError
+			if !errors.As(err, &ae) {
+				t.Errorf("%s: Decode() err = %v, want AttrError", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Decode() err = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Decode() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUserDecodeTarget(t *testing.T) {
+	var v decodeTarget
+	for _, target := range []interface{}{nil, v, new(int)} {
+		if err := (&User{}).Decode(target); err == nil {
+			t.Errorf("Decode(%T) err = nil, want error", target)
+		}
+	}
+}
+
+func TestManagerCheckAttr(t *testing.T) {
+	specs := []AttrSpec{{Key: "company_id", Type: AttrUint32, Required: true}, {Key: "admin", Type: AttrBool}}
+	tests := []struct {
+		name   string
+		reject bool
+		act    codec.ActionId
+		attr   map[string]string
+		want   error
+	}{
+		{"valid", true, 1, map[string]string{"company_id": "5", "admin": "1"}, nil},
+		{"missing", true, 1, map[string]string{"admin": "1"}, ErrAttrMissing},
+		{"invalid", true, 1, map[string]string{"company_id": "x"}, strconv.ErrSyntax},
+		{"not rejected", false, 1, map[string]string{}, nil},
+		{"close action", true, 0, map[string]string{}, nil},
+	}
+	for _, tt := range tests {
+		m := NewManager()
+		m.RegisterAttr(specs...)
+		m.RejectInvalidAttr(tt.reject)
+		req := NewHandlerReq("gw", codec.Action{Id: tt.act}, 1, &User{Attr: tt.attr}, nil, nil, nil, "", nil)
+		if err := m.CheckAttr(req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: CheckAttr() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
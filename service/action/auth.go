@@ -0,0 +1,138 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"strings"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// RolesAttr the user attribute of the comma separated roles
+const RolesAttr = "roles"
+
+// Roles return the roles of the user
+func (s *User) Roles() []string {
+	var roles []string
+	for _, r := range strings.Split(s.GetAttr(RolesAttr, ""), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// HasRole return if the user has the role
+func (s *User) HasRole(role string) bool {
+	for _, r := range s.Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Requirement the requirement of an action, checked before the action handler called
+type Requirement struct {
+	Authenticated bool              // the user must be authenticated, implied by the user requirements below
+	Roles         []string          // the user must have one of the roles
+	Attrs         []string          // the user must have the non-empty attributes, such as company_id
+	AttrValues    map[string]string // the user attributes must equal the values
+	TargetTypes   []string          // the target type must be one of the types
+	Policy        func(ctx context.Context, req *HandlerReq) error
+}
+
+func (r *Requirement) needUser() bool {
+	return r.Authenticated || len(r.Roles) > 0 || len(r.Attrs) > 0 || len(r.AttrValues) > 0
+}
+
+// Check check the request, return ErrUnauthenticated, ErrPermissionDenied or the policy error
+func (r *Requirement) Check(ctx context.Context, req *HandlerReq) error {
+	if r == nil {
+		return nil
+	}
+	if r.needUser() && (req.User == nil || req.User.Id == 0) {
+		return ErrUnauthenticated
+	}
+	if len(r.Roles) > 0 {
+		matched := false
+		for _, role := range r.Roles {
+			if req.User.HasRole(role) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ErrPermissionDenied
+		}
+	}
+	for _, k := range r.Attrs {
+		if req.User.GetAttr(k, "") == "" {
+			return ErrPermissionDenied
+		}
+	}
+	for k, v := range r.AttrValues {
+		if req.User.GetAttr(k, "") != v {
+			return ErrPermissionDenied
+		}
+	}
+	if len(r.TargetTypes) > 0 {
+		matched := false
+		for _, t := range r.TargetTypes {
+			if req.Target != nil && req.Target.Type == t {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ErrPermissionDenied
+		}
+	}
+	if r.Policy != nil {
+		return r.Policy(ctx, req)
+	}
+	return nil
+}
+
+// Policy the global policy checked for every action after the action requirements
+type Policy func(ctx context.Context, req *HandlerReq, requirements []*Requirement) error
+
+// Require set the requirements of the action, all the requirements must be satisfied
+func (m *Manager) Require(act codec.ActionId, requirements ...*Requirement) {
+	var list []*Requirement
+	if v, ok := m.requirements.Load(act); ok {
+		list = v.([]*Requirement)
+	}
+	for _, r := range requirements {
+		if r != nil {
+			list = append(list, r)
+		}
+	}
+	m.requirements.Store(act, list)
+}
+
+// SetPolicy set the global policy
+func (m *Manager) SetPolicy(p Policy) {
+	m.policy = p
+}
+
+// Authorize check the requirements of the request action and the global policy, the close action is always allowed
+func (m *Manager) Authorize(ctx context.Context, req *HandlerReq) error {
+	if req.Action.Id == m.closeAction.Id {
+		return nil
+	}
+	list := m.Requirements(req.Action.Id)
+	for _, r := range list {
+		if err := r.Check(ctx, req); err != nil {
+			return err
+		}
+	}
+	if m.policy != nil {
+		return m.policy(ctx, req, list)
+	}
+	return nil
+}
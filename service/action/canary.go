@@ -0,0 +1,64 @@
+package action
+
+import (
+	"encoding/json"
+	"hash/fnv"
+)
+
+// Canary the canary rule of a handler instance, the matched requests are routed to the canary instances
+type Canary struct {
+	Percent     int         `json:"percent,omitempty"`      // 0-100, the percentage of the routing keys
+	UidRanges   [][2]uint32 `json:"uid_ranges,omitempty"`   // the closed user id ranges
+	TargetTypes []string    `json:"target_types,omitempty"` // the target types limited, all if empty
+}
+
+// Match return if the request matches the rule, the target types limit first, and then the user id ranges or the percentage,
+// all the requests of the target types match if neither the ranges nor the percentage set
+func (c *Canary) Match(uid uint32, targetType, key string) bool {
+	if c == nil {
+		return false
+	}
+	if len(c.TargetTypes) > 0 {
+		matched := false
+		for _, t := range c.TargetTypes {
+			if t == targetType {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(c.UidRanges) == 0 && c.Percent <= 0 {
+		return true
+	}
+	for _, r := range c.UidRanges {
+		if uid > 0 && uid >= r[0] && uid <= r[1] {
+			return true
+		}
+	}
+	return c.Percent > 0 && int(KeyHash(key)%100) < c.Percent
+}
+
+// Encode return the json value registered under the canary key
+func (c *Canary) Encode() string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// ParseCanary parse the json value registered under the canary key
+func ParseCanary(val string) (*Canary, error) {
+	c := &Canary{}
+	if err := json.Unmarshal([]byte(val), c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// KeyHash return the stable hash of the routing key
+func KeyHash(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
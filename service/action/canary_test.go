@@ -0,0 +1,61 @@
+package action
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCanaryMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		canary *Canary
+		uid    uint32
+		typ    string
+		key    string
+		want   bool
+	}{
+		{"nil", nil, 1, "dev", "k", false},
+		{"empty", &Canary{}, 0, "", "k", true},
+		{"type matched", &Canary{TargetTypes: []string{"dev"}}, 0, "dev", "k", true},
+		{"type unmatched", &Canary{TargetTypes: []string{"dev"}}, 0, "app", "k", false},
+		{"uid in range", &Canary{UidRanges: [][2]uint32{{10, 20}}}, 10, "", "k", true},
+		{"uid range end", &Canary{UidRanges: [][2]uint32{{10, 20}}}, 20, "", "k", true},
+		{"uid out of range", &Canary{UidRanges: [][2]uint32{{10, 20}}}, 21, "", "k", false},
+		{"no uid", &Canary{UidRanges: [][2]uint32{{0, 20}}}, 0, "", "k", false},
+		{"uid in range type unmatched", &Canary{UidRanges: [][2]uint32{{10, 20}}, TargetTypes: []string{"dev"}}, 15, "app", "k", false},
+		{"percent 100", &Canary{Percent: 100}, 0, "", "k", true},
+		{"percent 0 with range", &Canary{UidRanges: [][2]uint32{{10, 20}}}, 5, "", "k", false},
+	}
+	for _, tt := range tests {
+		if got := tt.canary.Match(tt.uid, tt.typ, tt.key); got != tt.want {
+			t.Errorf("%s: Match(%d, %q, %q) = %v, want %v", tt.name, tt.uid, tt.typ, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCanaryPercent(t *testing.T) {
+	c := &Canary{Percent: 30}
+	matched := 0
+	for i := 0; i < 10000; i++ {
+		key := "user:" + strconv.Itoa(i)
+		m := c.Match(0, "", key)
+		if m != c.Match(0, "", key) {
+			t.Fatalf("Match(%q) not stable", key)
+		}
+		if m {
+			matched++
+		}
+	}
+	if matched < 2500 || matched > 3500 {
+		t.Errorf("percent 30 matched %d of 10000 keys, want about 3000", matched)
+	}
+}
+
+func TestCanaryEncode(t *testing.T) {
+	c := &Canary{Percent: 10, UidRanges: [][2]uint32{{1, 2}}, TargetTypes: []string{"dev"}}
+	got, err := ParseCanary(c.Encode())
+	if err != nil || !reflect.DeepEqual(got, c) {
+		t.Errorf("ParseCanary(%s) = %+v, %v, want %+v", c.Encode(), got, err, c)
+	}
+}
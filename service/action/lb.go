@@ -0,0 +1,64 @@
+package action
+
+import (
+	"strconv"
+)
+
+// LbMode the load balancing mode of an action on the gateway
+type LbMode string
+
+const (
+	LbRoundRobin LbMode = "round_robin"  // the gateway default
+	LbHashFd     LbMode = "hash_fd"      // the connection sticks to a server
+	LbHashBindId LbMode = "hash_bind_id" // the connections of the same bound id stick to a server
+	LbHashUser   LbMode = "hash_user"    // the connections of the same user stick to a server
+	LbPinned     LbMode = "pinned"       // the actions of the same group go to the same server, such as the legacy flb num
+)
+
+// Slb the server selector of a connection action set on the gateway by SetActionSlb, the gateway routes the action of the
+// connection to the handler server selected by the slb instead of its default balancing, the same slb selects the same server,
+// the hashed slbs of the sticky policies and the instance slb of InstanceSlb are both selectors of this kind
+type Slb int64
+
+// SlbDefault clear the slb of the connection action, the gateway default balancing is restored
+const SlbDefault Slb = 0
+
+// HashSlb return the slb of the hash key, never SlbDefault
+func HashSlb(key string) Slb {
+	return Slb(KeyHash(key)) + 1
+}
+
+// LbPolicy the load balancing policy of an action, published in the registration metadata
+type LbPolicy struct {
+	Mode     LbMode `json:"mode"`
+	BindType string `json:"bind_type,omitempty"` // the bound id type of LbHashBindId
+	Group    int    `json:"group,omitempty"`     // the group of LbPinned
+}
+
+// Sticky return if the policy sets the slb of the connections
+func (p *LbPolicy) Sticky() bool {
+	return p != nil && (p.Mode == LbHashFd || p.Mode == LbHashBindId || p.Mode == LbHashUser)
+}
+
+// Slb return the slb of the request set on the gateway, the gateway selects the server by it,
+// ok is false when the policy is not sticky or the request lacks the hash key
+func (p *LbPolicy) Slb(req *HandlerReq) (slb Slb, ok bool) {
+	if !p.Sticky() {
+		return 0, false
+	}
+	var key string
+	switch p.Mode {
+	case LbHashFd:
+		key = strconv.FormatInt(req.Fd, 10)
+	case LbHashBindId:
+		key = req.BindIds()[p.BindType]
+	case LbHashUser:
+		if req.User != nil && req.User.Id > 0 {
+			key = strconv.FormatUint(uint64(req.User.Id), 10)
+		}
+	}
+	if key == "" {
+		return 0, false
+	}
+	return HashSlb(string(p.Mode) + ":" + key), true
+}
@@ -0,0 +1,44 @@
+package action
+
+import (
+	"github.com/obnahsgnaw/socketutil/codec"
+	"testing"
+)
+
+func TestLbPolicySlb(t *testing.T) {
+	req := NewHandlerReq("gw", codec.Action{Id: 1}, 7, &User{Id: 3}, nil, map[string]string{"uid": "42"}, nil, "", nil)
+	anon := NewHandlerReq("gw", codec.Action{Id: 1}, 7, nil, nil, nil, nil, "", nil)
+	tests := []struct {
+		name   string
+		policy *LbPolicy
+		req    *HandlerReq
+		want   Slb
+		ok     bool
+	}{
+		{"nil", nil, req, SlbDefault, false},
+		{"round robin", &LbPolicy{Mode: LbRoundRobin}, req, SlbDefault, false},
+		{"pinned", &LbPolicy{Mode: LbPinned, Group: 2}, req, SlbDefault, false},
+		{"hash fd", &LbPolicy{Mode: LbHashFd}, req, HashSlb("hash_fd:7"), true},
+		{"hash bind id", &LbPolicy{Mode: LbHashBindId, BindType: "uid"}, req, HashSlb("hash_bind_id:42"), true},
+		{"hash bind id unbound", &LbPolicy{Mode: LbHashBindId, BindType: "sn"}, req, SlbDefault, false},
+		{"hash user", &LbPolicy{Mode: LbHashUser}, req, HashSlb("hash_user:3"), true},
+		{"hash user anonymous", &LbPolicy{Mode: LbHashUser}, anon, SlbDefault, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.policy.Slb(tt.req)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Slb() = %d %v, want %d %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHashSlb(t *testing.T) {
+	for _, key := range []string{"", "a", "hash_fd:1", "hash_user:1"} {
+		if HashSlb(key) == SlbDefault {
+			t.Errorf("HashSlb(%q) = SlbDefault", key)
+		}
+		if HashSlb(key) != HashSlb(key) {
+			t.Errorf("HashSlb(%q) not stable", key)
+		}
+	}
+}
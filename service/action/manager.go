@@ -2,6 +2,8 @@ package action
 
 import (
 	"context"
+	"errors"
+	"github.com/obnahsgnaw/sockethandler/service/session"
 	"github.com/obnahsgnaw/socketutil/codec"
 	"strconv"
 	"strings"
@@ -13,6 +15,12 @@ type Manager struct {
 	moduleHandlers sync.Map // module@action-id, action-handler
 	closeHandlers  []Handler
 	closeAction    codec.Action
+	replyMu        sync.Mutex
+	replies        map[string]chan *HandlerReq // reply-key, waiting request
+	middlewares    []Middleware
+	requirements   sync.Map // action-id, requirements
+	policy         Policy
+	attrs          attrSchema
 }
 
 func NewManager() *Manager {
@@ -29,6 +37,21 @@ type HandlerReq struct {
 	Target  *Target
 	cname   codec.Name
 	raw     []byte
+	gwAddr  GatewayAddr
+	closer  func(reason string) error
+	session *session.Manager
+}
+
+// ErrNoCloser the request has no closer to close the connection
+var ErrNoCloser = errors.New("request closer not set")
+
+type ReqOption func(q *HandlerReq)
+
+// Channel set the business channel of the gateway
+func Channel(channel string) ReqOption {
+	return func(q *HandlerReq) {
+		q.gwAddr.Channel = channel
+	}
 }
 
 func (q *HandlerReq) DataFormat() codec.Name {
@@ -44,11 +67,60 @@ func (q *HandlerReq) BondId(typ string) (string, bool) {
 	return id, ok
 }
 
-func NewHandlerReq(gw string, action codec.Action, fd int64, u *User, data codec.DataPtr, ids map[string]string, target *Target, cname codec.Name, raw []byte) *HandlerReq {
+// BindIds return a copy of the bound ids of the connection, type => id
+func (q *HandlerReq) BindIds() map[string]string {
+	ids := make(map[string]string, len(q.idMap))
+	for typ, id := range q.idMap {
+		ids[typ] = id
+	}
+	return ids
+}
+
+// SetSession set the session manager of the request
+func (q *HandlerReq) SetSession(m *session.Manager) {
+	q.session = m
+}
+
+// Session return the session of the request connection, nil if the session is not enabled, the nil session returns session.ErrNoStore
+func (q *HandlerReq) Session() *session.Session {
+	if q.session == nil {
+		return nil
+	}
+	return q.session.Conn(q.gwAddr.Host, q.Fd)
+}
+
+// BindSession return the session of the bound id of the type, shared by the connections bound with the same id
+func (q *HandlerReq) BindSession(typ string) (*session.Session, bool) {
+	id, ok := q.idMap[typ]
+	if !ok || q.session == nil {
+		return nil, false
+	}
+	return q.session.Bind(typ, id), true
+}
+
+// SetCloser set the closer of the request connection
+func (q *HandlerReq) SetCloser(closer func(reason string) error) {
+	q.closer = closer
+}
+
+// Close close the request connection with the reason, an error is returned when only the kick action is sent
+func (q *HandlerReq) Close(reason string) error {
+	if q.closer == nil {
+		return ErrNoCloser
+	}
+	return q.closer(reason)
+}
+
+// GatewayAddr return the parsed gateway address of the request
+func (q *HandlerReq) GatewayAddr() GatewayAddr {
+	return q.gwAddr
+}
+
+func NewHandlerReq(gw string, action codec.Action, fd int64, u *User, data codec.DataPtr, ids map[string]string, target *Target, cname codec.Name, raw []byte, o ...ReqOption) *HandlerReq {
 	if target == nil {
 		target = &Target{}
 	}
-	return &HandlerReq{
+	q := &HandlerReq{
 		Action:  action,
 		Gateway: gw,
 		Fd:      fd,
@@ -58,7 +130,14 @@ func NewHandlerReq(gw string, action codec.Action, fd int64, u *User, data codec
 		Target:  target,
 		cname:   cname,
 		raw:     raw,
+		gwAddr:  ParseGatewayAddr(gw),
+	}
+	for _, opt := range o {
+		if opt != nil {
+			opt(q)
+		}
 	}
+	return q
 }
 
 type User struct {
@@ -82,9 +161,10 @@ func (s *User) Uno() string {
 	return s.GetAttr("user_id", "")
 }
 
+// Cid return the company_id attribute, 0 when missing or invalid, use Uint32 to get the error
 func (s *User) Cid() uint32 {
-	v, _ := strconv.Atoi(s.GetAttr("company_id", "0"))
-	return uint32(v)
+	v, _, _ := s.Uint32("company_id")
+	return v
 }
 
 func (s *User) Cno() string {
@@ -95,14 +175,16 @@ func (s *User) CProject() string {
 	return s.GetAttr("company_project", "")
 }
 
+// COid return the company_organization_id attribute, 0 when missing or invalid, use Uint32 to get the error
 func (s *User) COid() uint32 {
-	v, _ := strconv.Atoi(s.GetAttr("company_organization_id", "0"))
-	return uint32(v)
+	v, _, _ := s.Uint32("company_organization_id")
+	return v
 }
 
+// Oid return the organization_id attribute, 0 when missing or invalid, use Uint32 to get the error
 func (s *User) Oid() uint32 {
-	v, _ := strconv.Atoi(s.GetAttr("organization_id", "0"))
-	return uint32(v)
+	v, _, _ := s.Uint32("organization_id")
+	return v
 }
 
 type Target struct {
@@ -119,6 +201,9 @@ type Handler func(context.Context, *HandlerReq) (codec.Action, codec.DataPtr, er
 
 type DataStructure func() codec.DataPtr
 
+// Middleware wrap the action handler, such as to observe or to reject the requests
+type Middleware func(next Handler) Handler
+
 type actionHandler struct {
 	action    codec.Action
 	structure DataStructure
@@ -157,6 +242,21 @@ func (m *Manager) GetHandler(actionId codec.ActionId) (codec.Action, DataStructu
 	return codec.Action{}, nil, nil, false
 }
 
+// Use add the middlewares to all the action handlers, the first one is the outermost, should be called before serving
+func (m *Manager) Use(mw ...Middleware) {
+	m.middlewares = append(m.middlewares, mw...)
+}
+
+// Wrap wrap the handler with the middlewares
+func (m *Manager) Wrap(handler Handler) Handler {
+	for i := len(m.middlewares) - 1; i >= 0; i-- {
+		if m.middlewares[i] != nil {
+			handler = m.middlewares[i](handler)
+		}
+	}
+	return handler
+}
+
 func (m *Manager) RangeHandlerActions(module string, handle func(action codec.Action) error) (err error) {
 	m.moduleHandlers.Range(func(key, value interface{}) bool {
 		keyStr := key.(string)
@@ -0,0 +1,84 @@
+package action
+
+import (
+	"encoding/json"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"strconv"
+	"strings"
+)
+
+// RegMeta the registration metadata of an action, registered as the json value of the action key
+type RegMeta struct {
+	Name       string       `json:"name"`
+	Flb        int          `json:"flb,omitempty"`
+	Version    string       `json:"version,omitempty"`
+	Weight     int          `json:"weight,omitempty"`
+	Codecs     []codec.Name `json:"codecs,omitempty"`
+	Deprecated bool         `json:"deprecated,omitempty"`
+	Auth       bool         `json:"auth,omitempty"`
+	Roles      []string     `json:"roles,omitempty"`
+	Lb         *LbPolicy    `json:"lb,omitempty"`
+}
+
+// Encode return the json value
+func (m RegMeta) Encode() string {
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// Legacy return the legacy value of name|flb
+func (m RegMeta) Legacy() string {
+	if m.Flb > 0 {
+		return m.Name + "|" + strconv.Itoa(m.Flb)
+	}
+	return m.Name
+}
+
+// SupportCodec return if the codec is supported, all the codecs are supported if not set
+func (m RegMeta) SupportCodec(name codec.Name) bool {
+	if len(m.Codecs) == 0 {
+		return true
+	}
+	for _, c := range m.Codecs {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRegMeta parse the registration value, both the json and the legacy name|flb format, the legacy flb is parsed as the pinned group
+func ParseRegMeta(val string) (m RegMeta, err error) {
+	val = strings.TrimSpace(val)
+	if strings.HasPrefix(val, "{") {
+		err = json.Unmarshal([]byte(val), &m)
+		return
+	}
+	m.Name = val
+	if i := strings.LastIndex(val, "|"); i >= 0 {
+		if num, err1 := strconv.Atoi(val[i+1:]); err1 == nil {
+			m.Name = val[:i]
+			m.Flb = num
+			m.Lb = &LbPolicy{Mode: LbPinned, Group: num}
+		}
+	}
+	return
+}
+
+// Requirements return the requirements of the action
+func (m *Manager) Requirements(act codec.ActionId) []*Requirement {
+	if v, ok := m.requirements.Load(act); ok {
+		return v.([]*Requirement)
+	}
+	return nil
+}
+
+// Meta fill the auth metadata of the action requirements
+func (m *Manager) Meta(act codec.ActionId, meta *RegMeta) {
+	for _, r := range m.Requirements(act) {
+		if r.needUser() {
+			meta.Auth = true
+		}
+		meta.Roles = append(meta.Roles, r.Roles...)
+	}
+}
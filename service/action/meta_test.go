@@ -0,0 +1,73 @@
+package action
+
+import (
+	"github.com/obnahsgnaw/socketutil/codec"
+	"reflect"
+	"testing"
+)
+
+func TestParseRegMeta(t *testing.T) {
+	tests := []struct {
+		val   string
+		want  RegMeta
+		isErr bool
+	}{
+		{"", RegMeta{}, false},
+		{"login", RegMeta{Name: "login"}, false},
+		{" login ", RegMeta{Name: "login"}, false},
+		{"login|3", RegMeta{Name: "login", Flb: 3, Lb: &LbPolicy{Mode: LbPinned, Group: 3}}, false},
+		{"a|b|2", RegMeta{Name: "a|b", Flb: 2, Lb: &LbPolicy{Mode: LbPinned, Group: 2}}, false},
+		{"login|x", RegMeta{Name: "login|x"}, false},
+		{"login|", RegMeta{Name: "login|"}, false},
+		{`{"name":"login","flb":3,"version":"v2","weight":5,"codecs":["json"],"deprecated":true}`,
+			RegMeta{Name: "login", Flb: 3, Version: "v2", Weight: 5, Codecs: []codec.Name{"json"}, Deprecated: true}, false},
+		{`{"name":"login","lb":{"mode":"pinned","group":2}}`,
+			RegMeta{Name: "login", Lb: &LbPolicy{Mode: LbPinned, Group: 2}}, false},
+		{`{"name":`, RegMeta{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRegMeta(tt.val)
+		if (err != nil) != tt.isErr {
+			t.Errorf("ParseRegMeta(%q) err = %v, want error %v", tt.val, err, tt.isErr)
+			continue
+		}
+		if !tt.isErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRegMeta(%q) = %+v, want %+v", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestRegMetaRoundTrip(t *testing.T) {
+	tests := []RegMeta{
+		{Name: "login"},
+		{Name: "login", Flb: 3},
+		{Name: "login", Version: "v1", Weight: 2, Codecs: []codec.Name{"proto"}, Auth: true, Roles: []string{"admin"}},
+	}
+	for _, m := range tests {
+		got, err := ParseRegMeta(m.Encode())
+		if err != nil || !reflect.DeepEqual(got, m) {
+			t.Errorf("ParseRegMeta(%s) = %+v, %v, want %+v", m.Encode(), got, err, m)
+		}
+		legacy, _ := ParseRegMeta(m.Legacy())
+		if legacy.Name != m.Name || legacy.Flb != m.Flb {
+			t.Errorf("ParseRegMeta(%q) = %+v, want name %q flb %d", m.Legacy(), legacy, m.Name, m.Flb)
+		}
+	}
+}
+
+func TestRegMetaSupportCodec(t *testing.T) {
+	tests := []struct {
+		codecs []codec.Name
+		name   codec.Name
+		want   bool
+	}{
+		{nil, codec.Json, true},
+		{[]codec.Name{codec.Proto}, codec.Proto, true},
+		{[]codec.Name{codec.Proto}, codec.Json, false},
+	}
+	for _, tt := range tests {
+		if got := (RegMeta{Codecs: tt.codecs}).SupportCodec(tt.name); got != tt.want {
+			t.Errorf("SupportCodec(%v, %s) = %v, want %v", tt.codecs, tt.name, got, tt.want)
+		}
+	}
+}
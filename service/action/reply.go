@@ -0,0 +1,50 @@
+package action
+
+import (
+	"errors"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"strconv"
+)
+
+// ErrReplyAwaited another request is waiting for the same reply
+var ErrReplyAwaited = errors.New("reply already awaited")
+
+// ReplyKey the correlation key of a reply action from a connection, seq is 0 when the reply carries no sequence number
+func ReplyKey(host string, fd int64, act codec.ActionId, seq uint64) string {
+	return host + "#" + strconv.FormatInt(fd, 10) + "@" + act.String() + "#" + strconv.FormatUint(seq, 10)
+}
+
+// Await wait for the reply of the key, the returned cancel func must be called when the waiting is over
+func (m *Manager) Await(key string) (<-chan *HandlerReq, func(), error) {
+	m.replyMu.Lock()
+	defer m.replyMu.Unlock()
+	if m.replies == nil {
+		m.replies = make(map[string]chan *HandlerReq)
+	}
+	if _, ok := m.replies[key]; ok {
+		return nil, nil, ErrReplyAwaited
+	}
+	ch := make(chan *HandlerReq, 1)
+	m.replies[key] = ch
+	return ch, func() {
+		m.replyMu.Lock()
+		defer m.replyMu.Unlock()
+		if m.replies[key] == ch {
+			delete(m.replies, key)
+		}
+	}, nil
+}
+
+// Reply deliver the reply to the waiting request, return false if no request is waiting
+func (m *Manager) Reply(key string, req *HandlerReq) bool {
+	m.replyMu.Lock()
+	ch, ok := m.replies[key]
+	if ok {
+		delete(m.replies, key)
+	}
+	m.replyMu.Unlock()
+	if ok {
+		ch <- req
+	}
+	return ok
+}
@@ -0,0 +1,76 @@
+package action
+
+import (
+	"context"
+	"strconv"
+)
+
+type tenantCtxKey struct{}
+
+// Tenant the tenant of the user, identified by the company attributes
+type Tenant struct {
+	Cid     uint32
+	Cno     string
+	Project string
+}
+
+// Tenant return the tenant of the user
+func (s *User) Tenant() Tenant {
+	return Tenant{Cid: s.Cid(), Cno: s.Cno(), Project: s.CProject()}
+}
+
+// Key return the tenant key prefixed with its source, cid:<company id> first and then cno:<company no>, empty if no tenant
+func (t Tenant) Key() string {
+	if t.Cid > 0 {
+		return "cid:" + strconv.FormatUint(uint64(t.Cid), 10)
+	}
+	if t.Cno != "" {
+		return "cno:" + t.Cno
+	}
+	return ""
+}
+
+func (t Tenant) Empty() bool {
+	return t.Key() == ""
+}
+
+func (t Tenant) scoped(name string) string {
+	if t.Empty() {
+		return name
+	}
+	return "tenant:" + t.Key() + ":" + name
+}
+
+// Group return the tenant scoped group name
+func (t Tenant) Group(name string) string {
+	return t.scoped(name)
+}
+
+// BindType return the tenant scoped bound id type
+func (t Tenant) BindType(typ string) string {
+	return t.scoped(typ)
+}
+
+// Same return if the two tenants are the same one
+func (t Tenant) Same(o Tenant) bool {
+	return t.Key() == o.Key()
+}
+
+// WithTenant return the context with the tenant
+func WithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, t)
+}
+
+// TenantFrom return the tenant of the context
+func TenantFrom(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(tenantCtxKey{}).(Tenant)
+	return t, ok
+}
+
+// Tenant return the tenant of the request user, empty if no user
+func (q *HandlerReq) Tenant() Tenant {
+	if q.User == nil {
+		return Tenant{}
+	}
+	return q.User.Tenant()
+}
@@ -0,0 +1,24 @@
+package action
+
+import "testing"
+
+func TestTenantKey(t *testing.T) {
+	tests := []struct {
+		tenant Tenant
+		want   string
+	}{
+		{Tenant{}, ""},
+		{Tenant{Cid: 5}, "cid:5"},
+		{Tenant{Cno: "5"}, "cno:5"},
+		{Tenant{Cid: 5, Cno: "x"}, "cid:5"},
+		{Tenant{Project: "p"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.tenant.Key(); got != tt.want {
+			t.Errorf("%+v.Key() = %q, want %q", tt.tenant, got, tt.want)
+		}
+	}
+	if (Tenant{Cid: 5}).Same(Tenant{Cno: "5"}) {
+		t.Error("company id 5 and company no 5 are the same tenant, want different")
+	}
+}
@@ -0,0 +1,312 @@
+package conn
+
+import (
+	"context"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Connection a connection seen by the handler
+type Connection struct {
+	Channel    string
+	Gateway    string
+	Fd         int64
+	User       *action.User
+	Target     action.Target
+	BindIds    map[string]string
+	Groups     map[string]struct{} // the groups joined through this instance
+	Format     codec.Name
+	FirstSeen  time.Time
+	LastActive time.Time
+}
+
+func (c Connection) Key() string {
+	return Key(c.Gateway, c.Fd)
+}
+
+// clone copy the connection with its own bound id and group maps
+func (c *Connection) clone() Connection {
+	cp := *c
+	cp.BindIds = make(map[string]string, len(c.BindIds))
+	for typ, id := range c.BindIds {
+		cp.BindIds[typ] = id
+	}
+	cp.Groups = make(map[string]struct{}, len(c.Groups))
+	for group := range c.Groups {
+		cp.Groups[group] = struct{}{}
+	}
+	return cp
+}
+
+// Uid return the user id, 0 if no user
+func (c Connection) Uid() uint32 {
+	if c.User == nil {
+		return 0
+	}
+	return c.User.Id
+}
+
+func Key(gateway string, fd int64) string {
+	return gateway + "#" + strconv.FormatInt(fd, 10)
+}
+
+func pairKey(typ, id string) string {
+	return typ + ":" + id
+}
+
+type index map[string]map[string]struct{}
+
+func (i index) add(k, connKey string) {
+	if k == "" {
+		return
+	}
+	if _, ok := i[k]; !ok {
+		i[k] = make(map[string]struct{})
+	}
+	i[k][connKey] = struct{}{}
+}
+
+func (i index) rm(k, connKey string) {
+	if keys, ok := i[k]; ok {
+		delete(keys, connKey)
+		if len(keys) == 0 {
+			delete(i, k)
+		}
+	}
+}
+
+// Registry the in-process registry of the connections, maintained from the handled requests, the bind calls and the close action
+type Registry struct {
+	sync.RWMutex
+	conns    map[string]*Connection
+	byHost   index
+	byUser   index
+	byBind   index
+	byTarget index
+	byGroup  index
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		conns:    make(map[string]*Connection),
+		byHost:   make(index),
+		byUser:   make(index),
+		byBind:   make(index),
+		byTarget: make(index),
+		byGroup:  make(index),
+	}
+}
+
+func (r *Registry) indexAdd(c *Connection) {
+	k := c.Key()
+	r.byHost.add(c.Gateway, k)
+	if c.Uid() > 0 {
+		r.byUser.add(strconv.FormatUint(uint64(c.Uid()), 10), k)
+	}
+	if c.Target.Type != "" || c.Target.Id != "" {
+		r.byTarget.add(pairKey(c.Target.Type, c.Target.Id), k)
+	}
+	for typ, id := range c.BindIds {
+		r.byBind.add(pairKey(typ, id), k)
+	}
+	for group := range c.Groups {
+		r.byGroup.add(group, k)
+	}
+}
+
+func (r *Registry) indexRm(c *Connection) {
+	k := c.Key()
+	r.byHost.rm(c.Gateway, k)
+	r.byUser.rm(strconv.FormatUint(uint64(c.Uid()), 10), k)
+	r.byTarget.rm(pairKey(c.Target.Type, c.Target.Id), k)
+	for typ, id := range c.BindIds {
+		r.byBind.rm(pairKey(typ, id), k)
+	}
+	for group := range c.Groups {
+		r.byGroup.rm(group, k)
+	}
+}
+
+func (r *Registry) upsert(gateway string, fd int64, update func(c *Connection)) {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	c, ok := r.conns[Key(gateway, fd)]
+	if ok {
+		r.indexRm(c)
+	} else {
+		c = &Connection{Gateway: gateway, Fd: fd, BindIds: make(map[string]string), Groups: make(map[string]struct{}), FirstSeen: now}
+		r.conns[c.Key()] = c
+	}
+	c.LastActive = now
+	update(c)
+	r.indexAdd(c)
+}
+
+// Touch add or update the connection of the request
+func (r *Registry) Touch(req *action.HandlerReq) {
+	addr := req.GatewayAddr()
+	r.upsert(addr.Host, req.Fd, func(c *Connection) {
+		c.Channel = addr.Channel
+		c.Format = req.DataFormat()
+		if req.User != nil {
+			c.User = req.User
+		}
+		if req.Target != nil {
+			c.Target = *req.Target
+		}
+		for typ, id := range req.BindIds() {
+			c.BindIds[typ] = id
+		}
+	})
+}
+
+// Bind add the bound ids to the connection
+func (r *Registry) Bind(gateway string, fd int64, ids map[string]string) {
+	r.upsert(gateway, fd, func(c *Connection) {
+		for typ, id := range ids {
+			c.BindIds[typ] = id
+		}
+	})
+}
+
+// Unbind remove the bound id types of the connection
+func (r *Registry) Unbind(gateway string, fd int64, types ...string) {
+	r.Lock()
+	defer r.Unlock()
+	c, ok := r.conns[Key(gateway, fd)]
+	if !ok {
+		return
+	}
+	r.indexRm(c)
+	for _, typ := range types {
+		delete(c.BindIds, typ)
+	}
+	r.indexAdd(c)
+}
+
+// Join add the groups joined by the connection
+func (r *Registry) Join(gateway string, fd int64, groups ...string) {
+	r.upsert(gateway, fd, func(c *Connection) {
+		for _, group := range groups {
+			c.Groups[group] = struct{}{}
+		}
+	})
+}
+
+// Leave remove the groups left by the connection
+func (r *Registry) Leave(gateway string, fd int64, groups ...string) {
+	r.Lock()
+	defer r.Unlock()
+	c, ok := r.conns[Key(gateway, fd)]
+	if !ok {
+		return
+	}
+	r.indexRm(c)
+	for _, group := range groups {
+		delete(c.Groups, group)
+	}
+	r.indexAdd(c)
+}
+
+// Remove remove the connection
+func (r *Registry) Remove(gateway string, fd int64) (Connection, bool) {
+	r.Lock()
+	defer r.Unlock()
+	c, ok := r.conns[Key(gateway, fd)]
+	if !ok {
+		return Connection{}, false
+	}
+	r.indexRm(c)
+	delete(r.conns, c.Key())
+	return c.clone(), true
+}
+
+// RemoveGateway remove all the connections of the gateway, used when the gateway leaved
+func (r *Registry) RemoveGateway(gateway string) (list []Connection) {
+	r.Lock()
+	defer r.Unlock()
+	for k := range r.byHost[gateway] {
+		if c, ok := r.conns[k]; ok {
+			r.indexRm(c)
+			delete(r.conns, k)
+			list = append(list, c.clone())
+		}
+	}
+	return
+}
+
+func (r *Registry) list(i index, k string) (list []Connection) {
+	r.RLock()
+	defer r.RUnlock()
+	for ck := range i[k] {
+		if c, ok := r.conns[ck]; ok {
+			list = append(list, c.clone())
+		}
+	}
+	return
+}
+
+// Get return the connection of the gateway fd
+func (r *Registry) Get(gateway string, fd int64) (Connection, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	if c, ok := r.conns[Key(gateway, fd)]; ok {
+		return c.clone(), true
+	}
+	return Connection{}, false
+}
+
+func (r *Registry) ByGateway(gateway string) []Connection {
+	return r.list(r.byHost, gateway)
+}
+
+func (r *Registry) ByUser(uid uint32) []Connection {
+	return r.list(r.byUser, strconv.FormatUint(uint64(uid), 10))
+}
+
+func (r *Registry) ByBindId(typ, id string) []Connection {
+	return r.list(r.byBind, pairKey(typ, id))
+}
+
+func (r *Registry) ByTarget(typ, id string) []Connection {
+	return r.list(r.byTarget, pairKey(typ, id))
+}
+
+// ByGroup return the connections joined the group through this instance
+func (r *Registry) ByGroup(group string) []Connection {
+	return r.list(r.byGroup, group)
+}
+
+// All return all the connections
+func (r *Registry) All() (list []Connection) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, c := range r.conns {
+		list = append(list, c.clone())
+	}
+	return
+}
+
+func (r *Registry) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.conns)
+}
+
+// Middleware track the connections of the handled requests, the connection is removed after the close action(id 0) handled
+func (r *Registry) Middleware() action.Middleware {
+	return func(next action.Handler) action.Handler {
+		return func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+			if req.Action.Id == 0 {
+				defer r.Remove(req.GatewayAddr().Host, req.Fd)
+			} else {
+				r.Touch(req)
+			}
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package conn
+
+import (
+	"context"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"sort"
+	"testing"
+)
+
+func keys(list []Connection) []string {
+	var ks []string
+	for _, c := range list {
+		ks = append(ks, c.Key())
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRegistryIndexes(t *testing.T) {
+	r := NewRegistry()
+	r.Touch(action.NewHandlerReq("gw1", codec.Action{Id: 1}, 1, &action.User{Id: 7}, nil, map[string]string{"uid": "7"}, &action.Target{Type: "dev", Id: "a"}, "", nil))
+	r.Touch(action.NewHandlerReq("gw1", codec.Action{Id: 1}, 2, &action.User{Id: 7}, nil, nil, nil, "", nil))
+	r.Touch(action.NewHandlerReq("gw2", codec.Action{Id: 1}, 1, nil, nil, nil, &action.Target{Type: "dev", Id: "b"}, "", nil))
+	r.Bind("gw2", 1, map[string]string{"uid": "7"})
+
+	tests := []struct {
+		name string
+		list []Connection
+		want []string
+	}{
+		{"gateway gw1", r.ByGateway("gw1"), []string{"gw1#1", "gw1#2"}},
+		{"gateway gw2", r.ByGateway("gw2"), []string{"gw2#1"}},
+		{"user 7", r.ByUser(7), []string{"gw1#1", "gw1#2"}},
+		{"user 8", r.ByUser(8), nil},
+		{"bind uid 7", r.ByBindId("uid", "7"), []string{"gw1#1", "gw2#1"}},
+		{"target dev a", r.ByTarget("dev", "a"), []string{"gw1#1"}},
+		{"target dev b", r.ByTarget("dev", "b"), []string{"gw2#1"}},
+		{"all", r.All(), []string{"gw1#1", "gw1#2", "gw2#1"}},
+	}
+	for _, tt := range tests {
+		if got := keys(tt.list); !equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(r *Registry)
+		bind    []string
+		gateway []string
+	}{
+		{"unbind", func(r *Registry) { r.Unbind("gw1", 1, "uid") }, nil, []string{"gw1#1", "gw1#2"}},
+		{"unbind other type", func(r *Registry) { r.Unbind("gw1", 1, "sn") }, []string{"gw1#1"}, []string{"gw1#1", "gw1#2"}},
+		{"remove", func(r *Registry) { r.Remove("gw1", 1) }, nil, []string{"gw1#2"}},
+		{"remove gateway", func(r *Registry) { r.RemoveGateway("gw1") }, nil, nil},
+		{"rebind", func(r *Registry) { r.Bind("gw1", 1, map[string]string{"uid": "8"}) }, nil, []string{"gw1#1", "gw1#2"}},
+	}
+	for _, tt := range tests {
+		r := NewRegistry()
+		r.Bind("gw1", 1, map[string]string{"uid": "7"})
+		r.Bind("gw1", 2, nil)
+		tt.update(r)
+		if got := keys(r.ByBindId("uid", "7")); !equal(got, tt.bind) {
+			t.Errorf("%s: ByBindId = %v, want %v", tt.name, got, tt.bind)
+		}
+		if got := keys(r.ByGateway("gw1")); !equal(got, tt.gateway) {
+			t.Errorf("%s: ByGateway = %v, want %v", tt.name, got, tt.gateway)
+		}
+	}
+}
+
+func TestRegistryClone(t *testing.T) {
+	r := NewRegistry()
+	r.Bind("gw1", 1, map[string]string{"uid": "7"})
+	c, _ := r.Get("gw1", 1)
+	c.BindIds["uid"] = "8"
+	if c, _ = r.Get("gw1", 1); c.BindIds["uid"] != "7" {
+		t.Errorf("BindIds[uid] = %s after changing the copy, want 7", c.BindIds["uid"])
+	}
+}
+
+func TestRegistryMiddleware(t *testing.T) {
+	r := NewRegistry()
+	h := r.Middleware()(func(ctx context.Context, req *action.HandlerReq) (codec.Action, codec.DataPtr, error) {
+		return codec.Action{}, nil, nil
+	})
+	tests := []struct {
+		act  codec.ActionId
+		want int
+	}{
+		{1, 1},
+		{2, 1},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		_, _, _ = h(context.Background(), action.NewHandlerReq("gw1", codec.Action{Id: tt.act}, 1, nil, nil, nil, nil, "", nil))
+		if got := r.Len(); got != tt.want {
+			t.Errorf("action %d: Len() = %d, want %d", tt.act, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(r *Registry)
+		want   []string
+	}{
+		{"joined", func(r *Registry) {}, []string{"gw1#1", "gw1#2"}},
+		{"leave", func(r *Registry) { r.Leave("gw1", 1, "room") }, []string{"gw1#2"}},
+		{"leave other group", func(r *Registry) { r.Leave("gw1", 1, "hall") }, []string{"gw1#1", "gw1#2"}},
+		{"remove", func(r *Registry) { r.Remove("gw1", 2) }, []string{"gw1#1"}},
+		{"touch", func(r *Registry) {
+			r.Touch(action.NewHandlerReq("gw1", codec.Action{Id: 1}, 1, nil, nil, nil, nil, "", nil))
+		}, []string{"gw1#1", "gw1#2"}},
+	}
+	for _, tt := range tests {
+		r := NewRegistry()
+		r.Join("gw1", 1, "room")
+		r.Join("gw1", 2, "room", "hall")
+		tt.update(r)
+		if got := keys(r.ByGroup("room")); !equal(got, tt.want) {
+			t.Errorf("%s: ByGroup = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"github.com/obnahsgnaw/sockethandler/internal/filekv"
+	"sync"
+)
+
+// FileStore keep the queues in json files of the dir, one file per key, the queues survive the handler restart
+type FileStore struct {
+	sync.Mutex
+	dir *filekv.Dir
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	d, err := filekv.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: d}, nil
+}
+
+func (s *FileStore) load(key string) ([]Message, error) {
+	var list []Message
+	if _, err := s.dir.Load(key, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *FileStore) save(key string, list []Message) error {
+	if len(list) == 0 {
+		return s.dir.Remove(key)
+	}
+	return s.dir.Save(key, list)
+}
+
+func (s *FileStore) Push(key string, msg Message, maxSize int) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	list, err := s.load(key)
+	if err != nil {
+		return 0, err
+	}
+	list, dropped := trim(append(list, msg), maxSize)
+	return dropped, s.save(key, list)
+}
+
+func (s *FileStore) Requeue(key string, list []Message) error {
+	if len(list) == 0 {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	queued, err := s.load(key)
+	if err != nil {
+		return err
+	}
+	return s.save(key, requeue(queued, list))
+}
+
+func (s *FileStore) Pop(key string) ([]Message, error) {
+	s.Lock()
+	defer s.Unlock()
+	list, err := s.load(key)
+	if err != nil {
+		return nil, err
+	}
+	return list, s.save(key, nil)
+}
+
+func (s *FileStore) Len(key string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	list, err := s.load(key)
+	return len(list), err
+}
@@ -0,0 +1,94 @@
+package outbox
+
+import (
+	"github.com/obnahsgnaw/socketutil/codec"
+	"sync"
+	"time"
+)
+
+// Message a packed message waiting for the bound id to connect
+type Message struct {
+	Action      codec.Action
+	PbMessage   []byte
+	JsonMessage []byte
+	ExpireAt    time.Time // zero means never expire
+}
+
+func (m Message) Expired(now time.Time) bool {
+	return !m.ExpireAt.IsZero() && now.After(m.ExpireAt)
+}
+
+// Store the message queues of the bound ids
+type Store interface {
+	// Push append the message to the queue of the key, the expired and the oldest messages exceeding the max size are dropped,
+	// return the dropped count
+	Push(key string, msg Message, maxSize int) (int, error)
+	// Requeue put the undelivered messages back to the front of the queue, they are kept even if the queue exceed the max size
+	Requeue(key string, list []Message) error
+	// Pop take all the messages of the key
+	Pop(key string) ([]Message, error)
+	// Len return the queue size of the key
+	Len(key string) (int, error)
+}
+
+// trim drop the expired and the oldest messages exceeding the max size, return the kept list and the dropped count
+func trim(list []Message, maxSize int) ([]Message, int) {
+	now := time.Now()
+	total := len(list)
+	valid := list[:0]
+	for _, m := range list {
+		if !m.Expired(now) {
+			valid = append(valid, m)
+		}
+	}
+	if maxSize > 0 && len(valid) > maxSize {
+		valid = valid[len(valid)-maxSize:]
+	}
+	return valid, total - len(valid)
+}
+
+func requeue(list, front []Message) []Message {
+	return append(append(make([]Message, 0, len(front)+len(list)), front...), list...)
+}
+
+// MemoryStore keep the queues in memory
+type MemoryStore struct {
+	sync.Mutex
+	queues map[string][]Message
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{queues: make(map[string][]Message)}
+}
+
+func (s *MemoryStore) Push(key string, msg Message, maxSize int) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	list, dropped := trim(append(s.queues[key], msg), maxSize)
+	s.queues[key] = list
+	return dropped, nil
+}
+
+func (s *MemoryStore) Requeue(key string, list []Message) error {
+	if len(list) == 0 {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.queues[key] = requeue(s.queues[key], list)
+	return nil
+}
+
+func (s *MemoryStore) Pop(key string) ([]Message, error) {
+	s.Lock()
+	defer s.Unlock()
+	list := s.queues[key]
+	delete(s.queues, key)
+	return list, nil
+}
+
+func (s *MemoryStore) Len(key string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.queues[key]), nil
+}
@@ -0,0 +1,90 @@
+package outbox
+
+import (
+	"github.com/obnahsgnaw/socketutil/codec"
+	"testing"
+	"time"
+)
+
+func msg(name string) Message {
+	return Message{Action: codec.Action{Name: name}}
+}
+
+func names(list []Message) (l []string) {
+	for _, m := range list {
+		l = append(l, m.Action.Name)
+	}
+	return
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func stores(t *testing.T) map[string]Store {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemoryStore(), "file": fs}
+}
+
+func TestStore(t *testing.T) {
+	expired := msg("expired")
+	expired.ExpireAt = time.Now().Add(-time.Second)
+	cases := []struct {
+		name        string
+		push        []Message
+		maxSize     int
+		requeue     []Message
+		wantDropped int
+		want        []string
+	}{
+		{"order kept", []Message{msg("a"), msg("b"), msg("c")}, 0, nil, 0, []string{"a", "b", "c"}},
+		{"oldest dropped", []Message{msg("a"), msg("b"), msg("c")}, 2, nil, 1, []string{"b", "c"}},
+		{"expired dropped", []Message{expired, msg("a")}, 0, nil, 1, []string{"a"}},
+		{"requeued to front", []Message{msg("c")}, 0, []Message{msg("a"), msg("b")}, 0, []string{"a", "b", "c"}},
+		{"requeued kept over max size", []Message{msg("c")}, 1, []Message{msg("a"), msg("b")}, 0, []string{"a", "b", "c"}},
+	}
+	for _, c := range cases {
+		for sn, s := range stores(t) {
+			t.Run(c.name+"/"+sn, func(t *testing.T) {
+				dropped := 0
+				for _, m := range c.push {
+					n, err := s.Push("k", m, c.maxSize)
+					if err != nil {
+						t.Fatal(err)
+					}
+					dropped += n
+				}
+				if err := s.Requeue("k", c.requeue); err != nil {
+					t.Fatal(err)
+				}
+				if dropped != c.wantDropped {
+					t.Errorf("dropped = %d, want %d", dropped, c.wantDropped)
+				}
+				if n, _ := s.Len("k"); n != len(c.want) {
+					t.Errorf("Len = %d, want %d", n, len(c.want))
+				}
+				list, err := s.Pop("k")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := names(list); !equal(got, c.want) {
+					t.Errorf("Pop = %v, want %v", got, c.want)
+				}
+				if n, _ := s.Len("k"); n != 0 {
+					t.Errorf("Len after Pop = %d, want 0", n)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package impl
+
+import (
+	"errors"
+	bindv1 "github.com/obnahsgnaw/socketapi/gen/bind/v1"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoAck the delivery ack is not enabled by the DeliveryAck option
+var ErrNoAck = errors.New("gateway delivery ack not enabled")
+
+// DefaultAckMaxBackoff the default max wait between the resends
+const DefaultAckMaxBackoff = 30 * time.Second
+
+// SeqData the message data carrying the sequence number for the client to ack
+type SeqData interface {
+	SetSeq(seq uint64)
+}
+
+// AckConfig the at-least-once delivery config
+type AckConfig struct {
+	Action      codec.Action                    // the ack action sent by the client
+	Structure   action.DataStructure            // the ack action data structure
+	AckSeq      func(data codec.DataPtr) uint64 // return the acked sequence number of the ack data
+	MaxAttempts int                             // the max send attempts include the first one
+	Backoff     time.Duration                   // the wait before the first resend, doubled every resend
+	MaxBackoff  time.Duration                   // the max wait between the resends, DefaultAckMaxBackoff if not set
+	OnFailed    func(m PendingMessage)          // called when the message is not acked after the max attempts or the connection closed
+}
+
+// PendingMessage a message waiting for the client ack
+type PendingMessage struct {
+	Seq      uint64
+	Key      string // the connection key host#fd or the bound id key type:id
+	Action   codec.Action
+	Attempts int
+	SentAt   time.Time
+}
+
+type pendingMessage struct {
+	PendingMessage
+	next   time.Time
+	resend func() error
+}
+
+type acker struct {
+	sync.Mutex
+	cnf     *AckConfig
+	seq     uint64
+	pending map[uint64]*pendingMessage
+	started bool
+}
+
+// newAcker return the acker with a copy of the config, the defaults are applied to the copy
+func newAcker(cnf *AckConfig) *acker {
+	c := *cnf
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultAckMaxBackoff
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = c.Backoff
+	}
+	return &acker{cnf: &c, pending: make(map[uint64]*pendingMessage)}
+}
+
+// backoff return the wait before the resend, doubled until the max backoff without overflowing
+func (a *acker) backoff(attempts int) time.Duration {
+	d := a.cnf.Backoff
+	for i := 1; i < attempts; i++ {
+		if d > a.cnf.MaxBackoff/2 {
+			return a.cnf.MaxBackoff
+		}
+		d <<= 1
+	}
+	return d
+}
+
+func connKey(host string, fd int64) string {
+	return host + "#" + strconv.FormatInt(fd, 10)
+}
+
+// DeliveryAck enable the at-least-once delivery of the SendFdMessageAck and SendIdMessageAck messages
+func DeliveryAck(cnf *AckConfig) GatewayOption {
+	return func(s *Gateway) {
+		if cnf != nil {
+			s.acker = newAcker(cnf)
+		}
+	}
+}
+
+// AckConfig return the delivery ack config with the defaults applied, nil if not enabled
+func (s *Gateway) AckConfig() *AckConfig {
+	if s.acker == nil {
+		return nil
+	}
+	return s.acker.cnf
+}
+
+func (s *Gateway) sendAcked(key string, act codec.Action, data SeqData, send func() error) (uint64, error) {
+	if s.acker == nil {
+		return 0, ErrNoAck
+	}
+	seq := atomic.AddUint64(&s.acker.seq, 1)
+	data.SetSeq(seq)
+	// pending before sending, so a fast ack is not missed
+	now := time.Now()
+	s.acker.Lock()
+	s.acker.pending[seq] = &pendingMessage{
+		PendingMessage: PendingMessage{Seq: seq, Key: key, Action: act, Attempts: 1, SentAt: now},
+		next:           now.Add(s.acker.backoff(1)),
+		resend:         send,
+	}
+	if !s.acker.started {
+		s.acker.started = true
+		go s.resendLoop()
+	}
+	s.acker.Unlock()
+	if err := send(); err != nil {
+		s.acker.Lock()
+		delete(s.acker.pending, seq)
+		s.acker.Unlock()
+		return seq, err
+	}
+	return seq, nil
+}
+
+// SendFdMessageAck send the message with a sequence number and resend it until the client acks it
+func (s *Gateway) SendFdMessageAck(gw string, fd int64, act codec.Action, data SeqData) (uint64, error) {
+	addr := action.ParseGatewayAddr(gw)
+	return s.sendAcked(connKey(addr.Host, fd), act, data, func() error {
+		return s.SendFdMessageAt(addr, fd, act, data)
+	})
+}
+
+// SendIdMessageAck send the message to the bound id on all gateways with a sequence number and resend it until the client acks it
+func (s *Gateway) SendIdMessageAck(id *bindv1.Id, act codec.Action, data SeqData) (uint64, error) {
+	return s.sendAcked(bindKey(id.Typ, id.Id), act, data, func() error {
+		return s.sendIdMessageAll(idTarget(id), act, data)
+	})
+}
+
+// Ack clear the pending message of the sequence number, only the message sent to the request connection or its bound ids is cleared
+func (s *Gateway) Ack(req *action.HandlerReq, seq uint64) bool {
+	if s.acker == nil {
+		return false
+	}
+	s.acker.Lock()
+	defer s.acker.Unlock()
+	m, ok := s.acker.pending[seq]
+	if !ok || !ackOwner(req, m.Key) {
+		return false
+	}
+	delete(s.acker.pending, seq)
+	return true
+}
+
+// ackOwner return if the pending key is the request connection or one of its bound ids
+func ackOwner(req *action.HandlerReq, key string) bool {
+	if key == connKey(req.GatewayAddr().Host, req.Fd) {
+		return true
+	}
+	for typ, id := range req.BindIds() {
+		if key == bindKey(typ, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending return the pending messages of the connection key or the bound id key
+func (s *Gateway) Pending(key string) (list []PendingMessage) {
+	if s.acker == nil {
+		return
+	}
+	s.acker.Lock()
+	defer s.acker.Unlock()
+	for _, m := range s.acker.pending {
+		if m.Key == key {
+			list = append(list, m.PendingMessage)
+		}
+	}
+	return
+}
+
+// PendingOfFd return the pending messages of the connection
+func (s *Gateway) PendingOfFd(gw string, fd int64) []PendingMessage {
+	return s.Pending(connKey(action.ParseGatewayAddr(gw).Host, fd))
+}
+
+// DropPending remove the pending messages of the connection and report them failed, used when the connection closed
+func (s *Gateway) DropPending(gw string, fd int64) {
+	if s.acker == nil {
+		return
+	}
+	key := connKey(action.ParseGatewayAddr(gw).Host, fd)
+	var failed []PendingMessage
+	s.acker.Lock()
+	for seq, m := range s.acker.pending {
+		if m.Key == key {
+			failed = append(failed, m.PendingMessage)
+			delete(s.acker.pending, seq)
+		}
+	}
+	s.acker.Unlock()
+	s.reportFailed(failed)
+}
+
+func (s *Gateway) reportFailed(list []PendingMessage) {
+	if s.acker.cnf.OnFailed == nil {
+		return
+	}
+	for _, m := range list {
+		s.acker.cnf.OnFailed(m)
+	}
+}
+
+func (s *Gateway) resendLoop() {
+	interval := s.acker.cnf.Backoff / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			var due []*pendingMessage
+			var failed []PendingMessage
+			s.acker.Lock()
+			for seq, m := range s.acker.pending {
+				if now.Before(m.next) {
+					continue
+				}
+				if m.Attempts >= s.acker.cnf.MaxAttempts {
+					failed = append(failed, m.PendingMessage)
+					delete(s.acker.pending, seq)
+					continue
+				}
+				m.Attempts++
+				m.SentAt = now
+				m.next = now.Add(s.acker.backoff(m.Attempts))
+				due = append(due, m)
+			}
+			s.acker.Unlock()
+			for _, m := range due {
+				_ = m.resend()
+			}
+			s.reportFailed(failed)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package impl
+
+import (
+	"context"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"testing"
+	"time"
+)
+
+func TestGatewayAckOwner(t *testing.T) {
+	req := action.NewHandlerReq("127.0.0.1:8001", codec.Action{}, 7, nil, nil, map[string]string{"uid": "42"}, nil, "", nil)
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{"own fd", connKey("127.0.0.1:8001", 7), true},
+		{"own bound id", bindKey("uid", "42"), true},
+		{"other fd", connKey("127.0.0.1:8001", 8), false},
+		{"other host", connKey("127.0.0.1:8002", 7), false},
+		{"other bound id", bindKey("uid", "43"), false},
+	}
+	for i, tt := range tests {
+		gw := NewGateway(context.Background(), "ack-test", nil, DeliveryAck(&AckConfig{}))
+		seq := uint64(i + 1)
+		gw.acker.pending[seq] = &pendingMessage{PendingMessage: PendingMessage{Seq: seq, Key: tt.key}}
+		if got := gw.Ack(req, seq); got != tt.want {
+			t.Errorf("%s: Ack() = %v, want %v", tt.name, got, tt.want)
+		}
+		if _, left := gw.acker.pending[seq]; left == tt.want {
+			t.Errorf("%s: pending left = %v, want %v", tt.name, left, !tt.want)
+		}
+	}
+}
+
+func TestAckerBackoff(t *testing.T) {
+	cnf := &AckConfig{Backoff: time.Second}
+	a := newAcker(cnf)
+	if cnf.MaxAttempts != 0 || cnf.MaxBackoff != 0 {
+		t.Errorf("newAcker() changed the caller config: %+v", cnf)
+	}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{6, DefaultAckMaxBackoff},
+		{100, DefaultAckMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := a.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
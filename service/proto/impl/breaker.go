@@ -0,0 +1,284 @@
+package impl
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen the call is short-circuited because the gateway host circuit is open
+var ErrCircuitOpen = errors.New("gateway circuit open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig the circuit breaker config of the gateway hosts
+type BreakerConfig struct {
+	Failures    int           // the consecutive failures to open the circuit
+	OpenTimeout time.Duration // the open duration before a half-open probe call
+	IsFailure   func(err error) bool
+}
+
+// DefaultBreakerConfig open after 5 consecutive failures and probe every 10 seconds
+func DefaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		Failures:    5,
+		OpenTimeout: 10 * time.Second,
+	}
+}
+
+// IsHostFailure return if the error means the host is unhealthy, the business errors of a healthy host are not counted,
+// codes.Unknown is not counted since the plain application errors of the gateway map to it
+func IsHostFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+type BreakerListener func(host string, from, to BreakerState)
+
+type hostBreaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// BreakerStats the circuit breaker counters of the gateway hosts
+type BreakerStats struct {
+	Opened   int64 // the transitions to open
+	Closed   int64 // the transitions to closed
+	Rejected int64 // the calls short-circuited by the open circuits
+	Open     int   // the hosts currently open or half-open
+}
+
+type transition struct {
+	host     string
+	from, to BreakerState
+}
+
+// breakers the circuit breakers of the gateway hosts
+type breakers struct {
+	sync.Mutex
+	cnf       *BreakerConfig
+	hosts     map[string]*hostBreaker
+	listeners []BreakerListener
+	stats     BreakerStats
+}
+
+func newBreakers() *breakers {
+	return &breakers{hosts: make(map[string]*hostBreaker)}
+}
+
+func (b *breakers) host(host string) *hostBreaker {
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &hostBreaker{}
+		b.hosts[host] = h
+	}
+	return h
+}
+
+// transit change the state under the lock, the returned transition is notified after unlocking
+func (b *breakers) transit(host string, h *hostBreaker, to BreakerState) *transition {
+	from := h.state
+	if from == to {
+		return nil
+	}
+	h.state = to
+	switch to {
+	case BreakerOpen:
+		b.stats.Opened++
+	case BreakerClosed:
+		b.stats.Closed++
+	}
+	return &transition{host: host, from: from, to: to}
+}
+
+// notify call the listeners out of the lock, so the listeners can query the breakers
+func (b *breakers) notify(t *transition) {
+	if t == nil {
+		return
+	}
+	b.Lock()
+	listeners := b.listeners
+	b.Unlock()
+	for _, l := range listeners {
+		l(t.host, t.from, t.to)
+	}
+}
+
+// allow check if the call to the host is allowed, an open circuit turns half-open after the timeout and allows one probe call
+func (b *breakers) allow(host string) error {
+	b.Lock()
+	t, err := b.allowLocked(host)
+	if err != nil {
+		b.stats.Rejected++
+	}
+	b.Unlock()
+	b.notify(t)
+	return err
+}
+
+func (b *breakers) allowLocked(host string) (*transition, error) {
+	if b.cnf == nil {
+		return nil, nil
+	}
+	h := b.host(host)
+	switch h.state {
+	case BreakerOpen:
+		if time.Since(h.openedAt) < b.cnf.OpenTimeout {
+			return nil, ErrCircuitOpen
+		}
+		h.probing = true
+		return b.transit(host, h, BreakerHalfOpen), nil
+	case BreakerHalfOpen:
+		if h.probing {
+			return nil, ErrCircuitOpen
+		}
+		h.probing = true
+		return nil, nil
+	default:
+		return nil, nil
+	}
+}
+
+// done report the call result of the host
+func (b *breakers) done(host string, err error) {
+	b.Lock()
+	t := b.doneLocked(host, err)
+	b.Unlock()
+	b.notify(t)
+}
+
+func (b *breakers) doneLocked(host string, err error) *transition {
+	if b.cnf == nil {
+		return nil
+	}
+	isFailure := IsHostFailure
+	if b.cnf.IsFailure != nil {
+		isFailure = b.cnf.IsFailure
+	}
+	h := b.host(host)
+	h.probing = false
+	if err == nil || !isFailure(err) {
+		h.failures = 0
+		return b.transit(host, h, BreakerClosed)
+	}
+	h.failures++
+	if h.state == BreakerHalfOpen || h.failures >= b.cnf.Failures {
+		h.openedAt = time.Now()
+		return b.transit(host, h, BreakerOpen)
+	}
+	return nil
+}
+
+// release end the call of the host without a result, such as canceled by the caller, the probe of a half-open circuit is released
+func (b *breakers) release(host string) {
+	b.Lock()
+	defer b.Unlock()
+	if b.cnf == nil {
+		return
+	}
+	b.host(host).probing = false
+}
+
+// available return if the host can be called now
+func (b *breakers) available(host string) bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.cnf == nil {
+		return true
+	}
+	h, ok := b.hosts[host]
+	if !ok {
+		return true
+	}
+	switch h.state {
+	case BreakerOpen:
+		return time.Since(h.openedAt) >= b.cnf.OpenTimeout
+	case BreakerHalfOpen:
+		return !h.probing
+	default:
+		return true
+	}
+}
+
+func (b *breakers) state(host string) BreakerState {
+	b.Lock()
+	defer b.Unlock()
+	if h, ok := b.hosts[host]; ok {
+		return h.state
+	}
+	return BreakerClosed
+}
+
+func (b *breakers) rm(host string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.hosts, host)
+}
+
+func (b *breakers) snapshot() BreakerStats {
+	b.Lock()
+	defer b.Unlock()
+	st := b.stats
+	for _, h := range b.hosts {
+		if h.state != BreakerClosed {
+			st.Open++
+		}
+	}
+	return st
+}
+
+// BreakerState return the circuit state of the gateway host
+func (s *Gateway) BreakerState(host string) BreakerState {
+	return s.breakers.state(host)
+}
+
+// BreakerStats return the circuit breaker counters
+func (s *Gateway) BreakerStats() BreakerStats {
+	return s.breakers.snapshot()
+}
+
+// CircuitBreaker enable the circuit breaker of the gateway hosts
+func CircuitBreaker(cnf *BreakerConfig) GatewayOption {
+	return func(s *Gateway) {
+		s.breakers.Lock()
+		defer s.breakers.Unlock()
+		s.breakers.cnf = cnf
+	}
+}
+
+// OnBreakerChange listen the circuit state changes of the gateway hosts
+func OnBreakerChange(l BreakerListener) GatewayOption {
+	return func(s *Gateway) {
+		if l == nil {
+			return
+		}
+		s.breakers.Lock()
+		defer s.breakers.Unlock()
+		s.breakers.listeners = append(s.breakers.listeners, l)
+	}
+}
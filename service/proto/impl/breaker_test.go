@@ -0,0 +1,116 @@
+package impl
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestBreakerStateMachine(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	business := status.Error(codes.Unknown, "business error")
+	type step struct {
+		wait      time.Duration
+		result    error // the call result reported when allowed
+		wantAllow bool
+		wantState BreakerState
+	}
+	cases := []struct {
+		name  string
+		steps []step
+	}{
+		{"opens after consecutive failures", []step{
+			{0, unavailable, true, BreakerClosed},
+			{0, unavailable, true, BreakerOpen},
+			{0, nil, false, BreakerOpen},
+		}},
+		{"success resets the failures", []step{
+			{0, unavailable, true, BreakerClosed},
+			{0, nil, true, BreakerClosed},
+			{0, unavailable, true, BreakerClosed},
+		}},
+		{"business errors are not host failures", []step{
+			{0, business, true, BreakerClosed},
+			{0, business, true, BreakerClosed},
+			{0, business, true, BreakerClosed},
+		}},
+		{"half-open probe closes", []step{
+			{0, unavailable, true, BreakerClosed},
+			{0, unavailable, true, BreakerOpen},
+			{20 * time.Millisecond, nil, true, BreakerClosed},
+		}},
+		{"half-open probe failure reopens", []step{
+			{0, unavailable, true, BreakerClosed},
+			{0, unavailable, true, BreakerOpen},
+			{20 * time.Millisecond, unavailable, true, BreakerOpen},
+			{0, nil, false, BreakerOpen},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := newBreakers()
+			b.cnf = &BreakerConfig{Failures: 2, OpenTimeout: 10 * time.Millisecond}
+			for i, st := range c.steps {
+				time.Sleep(st.wait)
+				err := b.allow("gw")
+				if allowed := err == nil; allowed != st.wantAllow {
+					t.Fatalf("step %d: allow err = %v, want allowed %v", i, err, st.wantAllow)
+				}
+				if err == nil {
+					b.done("gw", st.result)
+				}
+				if got := b.state("gw"); got != st.wantState {
+					t.Fatalf("step %d: state = %v, want %v", i, got, st.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenSingleProbe(t *testing.T) {
+	b := newBreakers()
+	b.cnf = &BreakerConfig{Failures: 1, OpenTimeout: time.Millisecond}
+	_ = b.allow("gw")
+	b.done("gw", status.Error(codes.Unavailable, "down"))
+	time.Sleep(2 * time.Millisecond)
+	if err := b.allow("gw"); err != nil {
+		t.Fatalf("probe allow err = %v, want nil", err)
+	}
+	if err := b.allow("gw"); err != ErrCircuitOpen {
+		t.Fatalf("second allow err = %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestBreakerListenerCanQuery(t *testing.T) {
+	gw := NewGateway(context.Background(), "test", nil, CircuitBreaker(&BreakerConfig{Failures: 1, OpenTimeout: time.Second}))
+	var got BreakerState
+	gw.With(OnBreakerChange(func(host string, from, to BreakerState) {
+		got = gw.BreakerState(host) // must not deadlock
+	}))
+	_ = gw.breakers.allow("gw")
+	gw.breakers.done("gw", status.Error(codes.Unavailable, "down"))
+	if got != BreakerOpen {
+		t.Fatalf("listener state = %v, want %v", got, BreakerOpen)
+	}
+	if st := gw.BreakerStats(); st.Opened != 1 || st.Open != 1 {
+		t.Fatalf("stats = %+v, want 1 opened and 1 open", st)
+	}
+}
+
+func TestBreakerReleaseProbe(t *testing.T) {
+	b := newBreakers()
+	b.cnf = &BreakerConfig{Failures: 1, OpenTimeout: time.Millisecond}
+	_ = b.allow("gw")
+	b.done("gw", status.Error(codes.Unavailable, "down"))
+	time.Sleep(2 * time.Millisecond)
+	_ = b.allow("gw")
+	b.release("gw")
+	if got := b.state("gw"); got != BreakerHalfOpen {
+		t.Fatalf("state after release = %v, want %v", got, BreakerHalfOpen)
+	}
+	if err := b.allow("gw"); err != nil {
+		t.Fatalf("allow after release err = %v, want nil", err)
+	}
+}
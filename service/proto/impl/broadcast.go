@@ -0,0 +1,142 @@
+package impl
+
+import (
+	"errors"
+	"github.com/obnahsgnaw/sockethandler/internal/fanout"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/conn"
+	"github.com/obnahsgnaw/socketutil/codec"
+)
+
+// ErrFilterUnsupported the broadcast filter can not be evaluated, the gateway excludes one bound id only,
+// the other predicates need the ConnRegistry option and the user or the target of the members seen by this instance
+var ErrFilterUnsupported = errors.New("gateway broadcast filter unsupported")
+
+// BroadcastFilter the members of the broadcast groups to skip or to keep
+type BroadcastFilter struct {
+	ExcludeFds  []int64           // exclude the member fds on any gateway
+	ExcludeIds  []string          // exclude the members bound with one of the ids
+	UserAttrs   map[string]string // only the members with all the user attributes
+	TargetTypes []string          // only the members with one of the target types
+}
+
+// gatewaySide return if the gateway applies the filter by itself
+func (f *BroadcastFilter) gatewaySide() bool {
+	return f == nil || (len(f.ExcludeFds) == 0 && len(f.ExcludeIds) <= 1 && len(f.UserAttrs) == 0 && len(f.TargetTypes) == 0)
+}
+
+func (f *BroadcastFilter) excludeId() string {
+	if f != nil && len(f.ExcludeIds) > 0 {
+		return f.ExcludeIds[0]
+	}
+	return ""
+}
+
+// match return if the member is kept, ErrFilterUnsupported if the member lacks the user or the target to evaluate the filter
+func (f *BroadcastFilter) match(c conn.Connection) (bool, error) {
+	for _, fd := range f.ExcludeFds {
+		if c.Fd == fd {
+			return false, nil
+		}
+	}
+	for _, id := range f.ExcludeIds {
+		for _, bound := range c.BindIds {
+			if bound == id {
+				return false, nil
+			}
+		}
+	}
+	if len(f.UserAttrs) > 0 {
+		if c.User == nil {
+			return false, ErrFilterUnsupported
+		}
+		for k, v := range f.UserAttrs {
+			if attr, ok := c.User.Attr[k]; !ok || attr != v {
+				return false, nil
+			}
+		}
+	}
+	if len(f.TargetTypes) > 0 {
+		if c.Target.Type == "" {
+			return false, ErrFilterUnsupported
+		}
+		matched := false
+		for _, typ := range f.TargetTypes {
+			if c.Target.Type == typ {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// BroadcastGroups broadcast to the groups on all gateways with the filter, return the last error.
+// A nil filter or a single excluded id is applied by the gateway, the repeated groups are broadcast once, but a member
+// joined in several groups receives the message once per group. The other filters are applied by the handler to the members
+// joined through this instance tracked by the ConnRegistry option, sent once per member, ErrFilterUnsupported returned
+// before sending when the registry is not enabled or a member lacks the user or the target to evaluate the filter
+func (s *Gateway) BroadcastGroups(groups []string, act codec.Action, data codec.DataPtr, filter *BroadcastFilter) error {
+	if !filter.gatewaySide() {
+		return s.broadcastFiltered(groups, act, data, filter)
+	}
+	pbMsg, jsonMsg, err := s.pack(data)
+	if err != nil {
+		return err
+	}
+	type call struct{ group, host string }
+	var (
+		calls []call
+		seen  = make(map[string]struct{}, len(groups))
+		hosts = s.Hosts()
+	)
+	for _, group := range groups {
+		if _, ok := seen[group]; ok {
+			continue
+		}
+		seen[group] = struct{}{}
+		for _, host := range hosts {
+			calls = append(calls, call{group, host})
+		}
+	}
+	return fanout.Run(len(calls), func(i int) error {
+		return s.broadcastPacked(calls[i].host, calls[i].group, act, pbMsg, jsonMsg, filter.excludeId())
+	})
+}
+
+// broadcastFiltered send to the tracked members of the groups matching the filter one by one
+func (s *Gateway) broadcastFiltered(groups []string, act codec.Action, data codec.DataPtr, filter *BroadcastFilter) error {
+	if s.conns == nil {
+		return ErrFilterUnsupported
+	}
+	var (
+		members []conn.Connection
+		seen    = make(map[string]struct{})
+	)
+	for _, group := range groups {
+		for _, c := range s.conns.ByGroup(group) {
+			if _, ok := seen[c.Key()]; ok {
+				continue
+			}
+			seen[c.Key()] = struct{}{}
+			ok, err := filter.match(c)
+			if err != nil {
+				return err
+			}
+			if ok {
+				members = append(members, c)
+			}
+		}
+	}
+	pbMsg, jsonMsg, err := s.pack(data)
+	if err != nil {
+		return err
+	}
+	return fanout.Run(len(members), func(i int) error {
+		addr := action.GatewayAddr{Host: members[i].Gateway, Channel: members[i].Channel}
+		return s.sendFdPacked(s.ctx, addr, members[i].Fd, act, pbMsg, jsonMsg)
+	})
+}
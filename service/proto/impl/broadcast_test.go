@@ -0,0 +1,61 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/conn"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"testing"
+)
+
+func TestBroadcastFilterMatch(t *testing.T) {
+	member := conn.Connection{
+		Fd:      1,
+		User:    &action.User{Id: 7, Attr: map[string]string{"role": "admin"}},
+		Target:  action.Target{Type: "dev"},
+		BindIds: map[string]string{"uid": "7"},
+	}
+	tests := []struct {
+		name   string
+		filter BroadcastFilter
+		member conn.Connection
+		want   bool
+		err    error
+	}{
+		{"no filter", BroadcastFilter{}, member, true, nil},
+		{"excluded fd", BroadcastFilter{ExcludeFds: []int64{2, 1}}, member, false, nil},
+		{"excluded id", BroadcastFilter{ExcludeIds: []string{"8", "7"}}, member, false, nil},
+		{"user attr", BroadcastFilter{UserAttrs: map[string]string{"role": "admin"}}, member, true, nil},
+		{"other user attr", BroadcastFilter{UserAttrs: map[string]string{"role": "guest"}}, member, false, nil},
+		{"target type", BroadcastFilter{TargetTypes: []string{"app", "dev"}}, member, true, nil},
+		{"other target type", BroadcastFilter{TargetTypes: []string{"app"}}, member, false, nil},
+		{"no user", BroadcastFilter{UserAttrs: map[string]string{"role": "admin"}}, conn.Connection{Fd: 1}, false, ErrFilterUnsupported},
+		{"no target", BroadcastFilter{TargetTypes: []string{"dev"}}, conn.Connection{Fd: 1}, false, ErrFilterUnsupported},
+	}
+	for _, tt := range tests {
+		got, err := tt.filter.match(tt.member)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%s: match() = %v, %v, want %v, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestGatewayBroadcastUnsupported(t *testing.T) {
+	reg := conn.NewRegistry()
+	reg.Join("gw1", 1, "room")
+	filter := &BroadcastFilter{TargetTypes: []string{"dev"}}
+	tests := []struct {
+		name string
+		o    []GatewayOption
+	}{
+		{"no registry", nil},
+		{"member without target", []GatewayOption{ConnRegistry(reg)}},
+	}
+	for _, tt := range tests {
+		gw := NewGateway(context.Background(), "broadcast-test", nil, tt.o...)
+		if err := gw.BroadcastGroups([]string{"room"}, codec.Action{Id: 1}, nil, filter); !errors.Is(err, ErrFilterUnsupported) {
+			t.Errorf("%s: BroadcastGroups() = %v, want ErrFilterUnsupported", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	bindv1 "github.com/obnahsgnaw/socketapi/gen/bind/v1"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"google.golang.org/grpc"
+)
+
+var (
+	// ErrCloseUnsupported neither the closer nor the kick action is set, the connection can not be closed
+	ErrCloseUnsupported = errors.New("gateway close not supported")
+	// ErrNoConnRegistry the connection registry is not set by the ConnRegistry option
+	ErrNoConnRegistry = errors.New("gateway connection registry not set")
+	// ErrKickOnly only the kick action is sent without the closer, the connection is open until the client disconnects
+	ErrKickOnly = errors.New("gateway kick sent, connection not closed")
+	// ErrCloseUnresolved the id is bound on the gateway but the fds are not tracked by the connection registry for the closer
+	ErrCloseUnresolved = errors.New("gateway bound connections not resolved")
+)
+
+// Closer close the connection of the gateway, the gateway close rpc is provided by the deployment
+type Closer func(ctx context.Context, cc *grpc.ClientConn, fd int64, reason string) error
+
+// ConnCloser set the closer of the gateway connections
+func ConnCloser(c Closer) GatewayOption {
+	return func(s *Gateway) {
+		s.closer = c
+	}
+}
+
+// KickAction set the final action sent to the connection before closing, the client is expected to disconnect on it
+func KickAction(act codec.Action, data func(reason string) codec.DataPtr) GatewayOption {
+	return func(s *Gateway) {
+		s.kickAction = act
+		s.kickData = data
+	}
+}
+
+// Close close the connection with the reason, the kick action is sent first if set,
+// ErrKickOnly returned when no closer set, the tracked state is kept until the close action of the connection
+func (s *Gateway) Close(gw string, fd int64, reason string) error {
+	return s.CloseAt(action.ParseGatewayAddr(gw), fd, reason)
+}
+
+func (s *Gateway) CloseAt(addr action.GatewayAddr, fd int64, reason string) error {
+	if s.closer == nil && s.kickData == nil {
+		return ErrCloseUnsupported
+	}
+	if s.kickData != nil {
+		if err := s.SendFdMessageAt(addr, fd, s.kickAction, s.kickData(reason)); err != nil && s.closer == nil {
+			return err
+		}
+	}
+	if s.closer == nil {
+		return ErrKickOnly
+	}
+	if err := s.call(OpConn, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
+		return s.closer(ctx, cc, fd, reason)
+	}); err != nil {
+		return err
+	}
+	s.forget(addr.Host, fd)
+	return nil
+}
+
+// CloseById close the connections bound with the id on all gateways, the gateways are asked by BindExist whether the id is bound,
+// without the closer the kick action is sent to the bound id by the gateway and ErrKickOnly returned,
+// with the closer the fds of the gateway are looked up in the connection registry, ErrCloseUnresolved returned if none tracked
+func (s *Gateway) CloseById(idType, id, reason string) (err error) {
+	if s.closer == nil && s.kickData == nil {
+		return ErrCloseUnsupported
+	}
+	if s.closer != nil && s.conns == nil {
+		return ErrNoConnRegistry
+	}
+	for _, host := range s.Hosts() {
+		addr := action.GatewayAddr{Host: host}
+		exist, err1 := s.BindExistAt(addr, id, idType)
+		if err1 != nil {
+			err = err1
+			continue
+		}
+		if !exist {
+			continue
+		}
+		if s.closer == nil {
+			if err1 = s.SendIdMessageAt(addr, idTarget(&bindv1.Id{Typ: idType, Id: id}), s.kickAction, s.kickData(reason)); err1 != nil {
+				err = err1
+			} else if err == nil {
+				err = ErrKickOnly
+			}
+			continue
+		}
+		var closed bool
+		for _, c := range s.conns.ByBindId(idType, id) {
+			if c.Gateway != host {
+				continue
+			}
+			closed = true
+			if err1 = s.CloseAt(addr, c.Fd, reason); err1 != nil {
+				err = err1
+			}
+		}
+		if !closed {
+			err = ErrCloseUnresolved
+		}
+	}
+	return
+}
+
+// forget remove the state tracked for the closed connection
+func (s *Gateway) forget(host string, fd int64) {
+	s.DropPending(host, fd)
+	s.DropSlb(host, fd)
+	if s.conns != nil {
+		s.conns.Remove(host, fd)
+	}
+}
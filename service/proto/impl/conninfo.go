@@ -0,0 +1,153 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	connv1 "github.com/obnahsgnaw/socketapi/gen/conninfo/v1"
+	"github.com/obnahsgnaw/sockethandler/internal/fanout"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"google.golang.org/grpc"
+	"net"
+	"time"
+)
+
+// ErrMalformedConnInfo the gateway returned a malformed connection info
+var ErrMalformedConnInfo = errors.New("malformed gateway conn info")
+
+// legacyTimeLayout the connect time layout of the gateways without the zone offset
+const legacyTimeLayout = "2006-01-02 15:04:05"
+
+type ConnInfo struct {
+	LocalAddr      net.Addr
+	RemoteAddr     net.Addr
+	ConnectAt      time.Time
+	SocketType     string
+	Uid            uint32
+	UName          string
+	TargetType     string
+	TargetId       string
+	TargetCid      uint32
+	TargetUid      uint32
+	TargetProtocol uint32
+	Local          LocalHints // not from the gateway, the local tracking of this handler instance
+}
+
+// LocalHints the connection state tracked by this handler instance only, the gateway conn info does not carry it,
+// Known is false when the ConnRegistry option is not enabled or the connection has not sent any action to this instance,
+// the bound ids may miss the ones bound by the other instances
+type LocalHints struct {
+	Known    bool
+	BindIds  map[string]string
+	UserAttr map[string]string
+	Format   codec.Name
+}
+type Addr struct {
+	net  string
+	addr string
+}
+
+func (a Addr) Network() string {
+	return a.net
+}
+func (a Addr) String() string {
+	return a.addr
+}
+
+// TimeLocation set the location of the gateway connect time without the zone offset, default the local location
+func TimeLocation(loc *time.Location) GatewayOption {
+	return func(s *Gateway) {
+		if loc != nil {
+			s.loc = loc
+		}
+	}
+}
+
+// parseConnectAt parse the connect time, RFC3339 with the zone offset or the legacy layout in the gateway location, empty means unknown
+func (s *Gateway) parseConnectAt(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(legacyTimeLayout, v, s.loc)
+}
+
+func (s *Gateway) ConnInfo(gw string, fd int64) (ConnInfo, error) {
+	return s.ConnInfoAt(action.ParseGatewayAddr(gw), fd)
+}
+
+func (s *Gateway) ConnInfoAt(addr action.GatewayAddr, fd int64) (ConnInfo, error) {
+	var resp *connv1.ConnInfoResponse
+	gw := addr.Host
+	err := s.call(OpConn, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
+		c := connv1.NewConnServiceClient(cc)
+		var err1 error
+		resp, err1 = c.Info(ctx, &connv1.ConnInfoRequest{
+			Fd: fd,
+		})
+		return err1
+	})
+
+	if err != nil {
+		return ConnInfo{}, err
+	}
+	if resp == nil {
+		return ConnInfo{}, ErrMalformedConnInfo
+	}
+
+	t, err := s.parseConnectAt(resp.ConnectAt)
+	if err != nil {
+		return ConnInfo{}, fmt.Errorf("%w: connect_at %q, %s", ErrMalformedConnInfo, resp.ConnectAt, err.Error())
+	}
+	info := ConnInfo{
+		LocalAddr:      Addr{net: resp.LocalNetwork, addr: resp.LocalAddr},
+		RemoteAddr:     Addr{net: resp.RemoteNetwork, addr: resp.RemoteAddr},
+		ConnectAt:      t,
+		SocketType:     resp.SocketType,
+		Uid:            resp.Uid,
+		UName:          resp.Uname,
+		TargetType:     resp.TargetType,
+		TargetId:       resp.TargetId,
+		TargetCid:      resp.TargetCid,
+		TargetUid:      resp.TargetUid,
+		TargetProtocol: resp.TargetProtocol,
+	}
+	if s.conns != nil {
+		if c, ok := s.conns.Get(gw, fd); ok {
+			info.Local.Known = true
+			info.Local.BindIds = c.BindIds
+			info.Local.Format = c.Format
+			if c.User != nil {
+				info.Local.UserAttr = make(map[string]string, len(c.User.Attr))
+				for k, v := range c.User.Attr {
+					info.Local.UserAttr[k] = v
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// ConnInfos return the connection infos of the fds on the gateway, the fds failed are absent in the result and the last error returned
+func (s *Gateway) ConnInfos(gw string, fds ...int64) (map[int64]ConnInfo, error) {
+	addr := action.ParseGatewayAddr(gw)
+	infos := make([]*ConnInfo, len(fds))
+	err := fanout.Run(len(fds), func(i int) error {
+		info, err := s.ConnInfoAt(addr, fds[i])
+		if err != nil {
+			return err
+		}
+		infos[i] = &info
+		return nil
+	})
+	list := make(map[int64]ConnInfo, len(fds))
+	for i, info := range infos {
+		if info != nil {
+			list[fds[i]] = *info
+		}
+	}
+	return list, err
+}
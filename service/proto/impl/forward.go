@@ -0,0 +1,79 @@
+package impl
+
+import (
+	"context"
+	handlerv1 "github.com/obnahsgnaw/socketapi/gen/handler/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"sync/atomic"
+)
+
+// ForwardedKey the metadata key marking the request forwarded by another handler, the forwarded requests are not forwarded again
+const ForwardedKey = "x-handler-forwarded"
+
+// Forwarder forward the request to another handler, handled false means the request is handled locally
+type Forwarder func(ctx context.Context, q *handlerv1.HandleRequest) (resp *handlerv1.HandleResponse, handled bool, err error)
+
+// Forward set the forwarder of the business channel, nil to remove
+func (s *HandlerService) Forward(channel string, f Forwarder) {
+	if f == nil {
+		s.forwarders.Delete(channel)
+		return
+	}
+	s.forwarders.Store(channel, f)
+}
+
+// ForwardStats the forwarding counters of the handler service
+type ForwardStats struct {
+	Forwarded  int64 // the requests forwarded to other handlers
+	Failed     int64 // the forwarded requests failed
+	Received   int64 // the requests forwarded by other handlers
+	Unresolved int64 // the requests forwarded by other handlers but not served locally, not forwarded again to avoid the loop
+}
+
+type forwardStats struct {
+	forwarded  atomic.Int64
+	failed     atomic.Int64
+	received   atomic.Int64
+	unresolved atomic.Int64
+}
+
+// ForwardStats return the forwarding counters
+func (s *HandlerService) ForwardStats() ForwardStats {
+	return ForwardStats{
+		Forwarded:  s.stats.forwarded.Load(),
+		Failed:     s.stats.failed.Load(),
+		Received:   s.stats.received.Load(),
+		Unresolved: s.stats.unresolved.Load(),
+	}
+}
+
+func (s *HandlerService) forward(ctx context.Context, q *handlerv1.HandleRequest) (*handlerv1.HandleResponse, bool, error) {
+	if Forwarded(ctx) {
+		s.stats.received.Add(1)
+		return nil, false, nil
+	}
+	v, ok := s.forwarders.Load(q.BusinessChannel)
+	if !ok {
+		return nil, false, nil
+	}
+	resp, handled, err := v.(Forwarder)(ctx, q)
+	if handled {
+		s.stats.forwarded.Add(1)
+		if err != nil {
+			s.stats.failed.Add(1)
+		}
+	}
+	return resp, handled, err
+}
+
+// Forwarded return if the request is forwarded by another handler
+func Forwarded(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(ForwardedKey)) > 0
+}
+
+// ForwardTo call the handler of the connection with the request marked forwarded
+func ForwardTo(ctx context.Context, cc *grpc.ClientConn, from string, q *handlerv1.HandleRequest) (*handlerv1.HandleResponse, error) {
+	return handlerv1.NewHandlerServiceClient(cc).Handle(metadata.AppendToOutgoingContext(ctx, ForwardedKey, from), q)
+}
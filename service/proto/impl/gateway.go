@@ -2,33 +2,65 @@ package impl
 
 import (
 	"context"
+	"errors"
 	"github.com/obnahsgnaw/rpc/pkg/rpcclient"
 	bindv1 "github.com/obnahsgnaw/socketapi/gen/bind/v1"
-	connv1 "github.com/obnahsgnaw/socketapi/gen/conninfo/v1"
 	groupv1 "github.com/obnahsgnaw/socketapi/gen/group/v1"
 	messagev1 "github.com/obnahsgnaw/socketapi/gen/message/v1"
 	slbv1 "github.com/obnahsgnaw/socketapi/gen/slb/v1"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/conn"
 	"github.com/obnahsgnaw/socketutil/codec"
 	"google.golang.org/grpc"
-	"net"
-	"strings"
-	"sync"
 	"time"
 )
 
 type Gateway struct {
-	ctx context.Context
-	m   *rpcclient.Manager
-	dbp codec.DataBuilderProvider
-	id  string
-}
-
-func NewGateway(ctx context.Context, id string, m *rpcclient.Manager) *Gateway {
-	return &Gateway{
-		ctx: ctx,
-		m:   m,
-		dbp: codec.NewDbp(),
-		id:  id,
+	ctx             context.Context
+	m               *rpcclient.Manager
+	dbp             codec.DataBuilderProvider
+	id              string
+	retries         map[OpClass]*RetryPolicy
+	budget          *RetryBudget
+	breakers        *breakers
+	outbox          *outboxConfig
+	outboxListeners []OutboxListener
+	acker           *acker
+	replies         *action.Manager
+	reqSeq          uint64
+	conns           *conn.Registry
+	strictTenant    bool
+	loc             *time.Location
+	closer          Closer
+	kickAction      codec.Action
+	kickData        func(reason string) codec.DataPtr
+	slbs            *slbs
+	channel         string
+}
+
+type GatewayOption func(s *Gateway)
+
+func NewGateway(ctx context.Context, id string, m *rpcclient.Manager, o ...GatewayOption) *Gateway {
+	s := &Gateway{
+		ctx:      ctx,
+		m:        m,
+		dbp:      codec.NewDbp(),
+		id:       id,
+		retries:  make(map[OpClass]*RetryPolicy),
+		breakers: newBreakers(),
+		loc:      time.Local,
+		slbs:     newSlbs(),
+	}
+	s.With(o...)
+	return s
+}
+
+// With apply the options
+func (s *Gateway) With(o ...GatewayOption) {
+	for _, opt := range o {
+		if opt != nil {
+			opt(s)
+		}
 	}
 }
 
@@ -40,18 +72,108 @@ func (s *Gateway) Manager() *rpcclient.Manager {
 	return s.m
 }
 
-func (s *Gateway) ParseRqId(gw string) (string, string) {
-	if strings.Contains(gw, ":@") {
-		gws := strings.Split(gw, "@")
-		return gws[1], gws[0]
+// ErrChannelMismatch the gateway address belongs to another business channel
+var ErrChannelMismatch = errors.New("gateway channel mismatch")
+
+// Channel set the business channel of the gateway, the addresses of other channels are rejected
+func Channel(channel string) GatewayOption {
+	return func(s *Gateway) {
+		s.channel = channel
+	}
+}
+
+// ChannelName return the business channel of the gateway
+func (s *Gateway) ChannelName() string {
+	return s.channel
+}
+
+// ConnRegistry mirror the bind calls to the connection registry
+func ConnRegistry(r *conn.Registry) GatewayOption {
+	return func(s *Gateway) {
+		s.conns = r
+	}
+}
+
+// AddHost add a gateway host
+// AddHost add a gateway host, the queued outbox messages of the ids bound on the host are flushed
+func (s *Gateway) AddHost(host string) {
+	s.m.Add("gateway", host)
+	if s.outbox != nil {
+		go s.FlushQueued(host)
+	}
+}
+
+// RmHost remove a gateway host and the state tracked for it
+func (s *Gateway) RmHost(host string) {
+	s.m.Rm("gateway", host)
+	s.breakers.rm(host)
+}
+
+// AllHosts return all the known gateway hosts, include the hosts with an open circuit
+func (s *Gateway) AllHosts() []string {
+	return s.m.Get("gateway")
+}
+
+// Hosts return the gateway hosts, the hosts with an open circuit are skipped
+func (s *Gateway) Hosts() (hosts []string) {
+	for _, host := range s.m.Get("gateway") {
+		if s.breakers.available(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return
+}
+
+// call the gateway host with the retry policy of the operation class, the address of another channel is rejected
+func (s *Gateway) call(op OpClass, idempotent bool, addr action.GatewayAddr, handler func(ctx context.Context, cc *grpc.ClientConn) error) error {
+	return s.callCtx(s.ctx, op, idempotent, addr, handler)
+}
+
+// callCtx call the gateway with the context, the retries stop when the context done,
+// the calls ended by the context of the caller are not counted by the circuit breaker and the retry budget
+func (s *Gateway) callCtx(ctx context.Context, op OpClass, idempotent bool, addr action.GatewayAddr, handler func(ctx context.Context, cc *grpc.ClientConn) error) (err error) {
+	if addr.Channel != "" && s.channel != "" && addr.Channel != s.channel {
+		return ErrChannelMismatch
+	}
+	host, rqId := addr.Host, addr.RqId
+	p := s.retries[op]
+	for attempt := 1; ; attempt++ {
+		if err = s.breakers.allow(host); err != nil {
+			return
+		}
+		err = s.m.HostCall(ctx, host, op.priority(), s.id, "gateway", rqId, "", "", handler)
+		if err != nil && ctx.Err() != nil {
+			s.breakers.release(host)
+			return
+		}
+		s.breakers.done(host, err)
+		if err == nil {
+			s.budget.success()
+			return
+		}
+		s.budget.failure()
+		if !p.retry(attempt, idempotent, err) || !s.budget.allow() {
+			return
+		}
+		if !sleepCtx(ctx, p.backoff(attempt)) {
+			return
+		}
 	}
-	return gw, ""
+}
+
+// ParseRqId parse the gateway string to the host and the request id
+func (s *Gateway) ParseRqId(gw string) (string, string) {
+	addr := action.ParseGatewayAddr(gw)
+	return addr.Host, addr.RqId
 }
 
 func (s *Gateway) BindId(gw string, fd int64, id ...*bindv1.Id) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	return s.BindIdAt(action.ParseGatewayAddr(gw), fd, id...)
+}
+
+func (s *Gateway) BindIdAt(addr action.GatewayAddr, fd int64, id ...*bindv1.Id) error {
+	gw := addr.Host
+	err := s.call(OpBind, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := bindv1.NewBindServiceClient(cc)
 
 		_, err := c.BindId(ctx, &bindv1.BindIdRequest{
@@ -60,12 +182,26 @@ func (s *Gateway) BindId(gw string, fd int64, id ...*bindv1.Id) error {
 		})
 		return err
 	})
+	if err == nil && s.conns != nil {
+		ids := make(map[string]string, len(id))
+		for _, v := range id {
+			ids[v.Typ] = v.Id
+		}
+		s.conns.Bind(gw, fd, ids)
+	}
+	if err == nil && s.outbox != nil {
+		go s.deliverQueued(addr, fd, id)
+	}
+	return err
 }
 
 func (s *Gateway) UnBindId(gw string, fd int64, typ ...string) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	return s.UnBindIdAt(action.ParseGatewayAddr(gw), fd, typ...)
+}
+
+func (s *Gateway) UnBindIdAt(addr action.GatewayAddr, fd int64, typ ...string) error {
+	gw := addr.Host
+	err := s.call(OpBind, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := bindv1.NewBindServiceClient(cc)
 
 		_, err := c.UnBindId(ctx, &bindv1.UnBindIdRequest{
@@ -74,13 +210,19 @@ func (s *Gateway) UnBindId(gw string, fd int64, typ ...string) error {
 		})
 		return err
 	})
+	if err == nil && s.conns != nil {
+		s.conns.Unbind(gw, fd, typ...)
+	}
+	return err
 }
 
 func (s *Gateway) BindExist(gw string, id, typ string) (bool, error) {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
+	return s.BindExistAt(action.ParseGatewayAddr(gw), id, typ)
+}
+
+func (s *Gateway) BindExistAt(addr action.GatewayAddr, id, typ string) (bool, error) {
 	var p *bindv1.BindExistResponse
-	err := s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	err := s.call(OpBind, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := bindv1.NewBindServiceClient(cc)
 
 		var err1 error
@@ -100,7 +242,7 @@ func (s *Gateway) BindExist(gw string, id, typ string) (bool, error) {
 }
 
 func (s *Gateway) BindExistAll(id, idType string) (bool, error) {
-	for _, gw := range s.m.Get("gateway") {
+	for _, gw := range s.Hosts() {
 		exist, err := s.BindExist(gw, id, idType)
 		if err != nil {
 			return false, err
@@ -114,9 +256,11 @@ func (s *Gateway) BindExistAll(id, idType string) (bool, error) {
 }
 
 func (s *Gateway) BindProxyTarget(gw string, fd int64, target ...string) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	return s.BindProxyTargetAt(action.ParseGatewayAddr(gw), fd, target...)
+}
+
+func (s *Gateway) BindProxyTargetAt(addr action.GatewayAddr, fd int64, target ...string) error {
+	return s.call(OpBind, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := bindv1.NewBindServiceClient(cc)
 
 		_, err := c.BindProxyTarget(ctx, &bindv1.ProxyTargetRequest{
@@ -128,9 +272,11 @@ func (s *Gateway) BindProxyTarget(gw string, fd int64, target ...string) error {
 }
 
 func (s *Gateway) UnbindProxyTarget(gw string, fd int64, target ...string) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	return s.UnbindProxyTargetAt(action.ParseGatewayAddr(gw), fd, target...)
+}
+
+func (s *Gateway) UnbindProxyTargetAt(addr action.GatewayAddr, fd int64, target ...string) error {
+	return s.call(OpBind, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := bindv1.NewBindServiceClient(cc)
 
 		_, err := c.UnbindProxyTarget(ctx, &bindv1.ProxyTargetRequest{
@@ -143,8 +289,8 @@ func (s *Gateway) UnbindProxyTarget(gw string, fd int64, target ...string) error
 
 func (s *Gateway) TargetBindId(target, bindType string) (*bindv1.Id, error) {
 	var resp *bindv1.TargetBindIdResponse
-	for _, gw := range s.m.Get("gateway") {
-		err := s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", "", "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	for _, gw := range s.Hosts() {
+		err := s.call(OpBind, true, action.GatewayAddr{Host: gw}, func(ctx context.Context, cc *grpc.ClientConn) error {
 			c := bindv1.NewBindServiceClient(cc)
 			var err1 error
 			resp, err1 = c.TargetBindId(ctx, &bindv1.TargetBindIdRequest{
@@ -163,81 +309,44 @@ func (s *Gateway) TargetBindId(target, bindType string) (*bindv1.Id, error) {
 	return nil, nil
 }
 
-type ConnInfo struct {
-	LocalAddr      net.Addr
-	RemoteAddr     net.Addr
-	ConnectAt      time.Time
-	SocketType     string
-	Uid            uint32
-	UName          string
-	TargetType     string
-	TargetId       string
-	TargetCid      uint32
-	TargetUid      uint32
-	TargetProtocol uint32
-}
-type Addr struct {
-	net  string
-	addr string
+func (s *Gateway) SendFdMessage(gw string, fd int64, act codec.Action, data codec.DataPtr) error {
+	return s.SendFdMessageAt(action.ParseGatewayAddr(gw), fd, act, data)
 }
 
-func (a Addr) Network() string {
-	return a.net
-}
-func (a Addr) String() string {
-	return a.addr
+func (s *Gateway) SendFdMessageAt(addr action.GatewayAddr, fd int64, act codec.Action, data codec.DataPtr) error {
+	pbMsg, jsonMsg, err := s.pack(data)
+	if err != nil {
+		return err
+	}
+	return s.sendFdPacked(s.ctx, addr, fd, act, pbMsg, jsonMsg)
 }
 
-func (s *Gateway) ConnInfo(gw string, fd int64) (ConnInfo, error) {
-	var rqId string
-	var resp *connv1.ConnInfoResponse
-	gw, rqId = s.ParseRqId(gw)
-	err := s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
-		c := connv1.NewConnServiceClient(cc)
-		var err1 error
-		resp, err1 = c.Info(ctx, &connv1.ConnInfoRequest{
-			Fd: fd,
-		})
-		return err1
-	})
-
+// SendFdMessageCtx send the message to the connection with the context, the sending and its retries stop when the context done,
+// the connection is checked against the tenant of the context by CheckTenant, the sending without a context is not checked
+func (s *Gateway) SendFdMessageCtx(ctx context.Context, addr action.GatewayAddr, fd int64, act codec.Action, data codec.DataPtr) error {
+	if err := s.checkTenantAt(ctx, addr, fd); err != nil {
+		return err
+	}
+	pbMsg, jsonMsg, err := s.pack(data)
 	if err != nil {
-		return ConnInfo{}, err
+		return err
 	}
+	return s.sendFdPacked(ctx, addr, fd, act, pbMsg, jsonMsg)
+}
 
-	t, _ := time.Parse("2006-01-02 15:04:05", resp.ConnectAt)
-	return ConnInfo{
-		LocalAddr:      Addr{net: resp.LocalNetwork, addr: resp.LocalAddr},
-		RemoteAddr:     Addr{net: resp.RemoteNetwork, addr: resp.RemoteAddr},
-		ConnectAt:      t,
-		SocketType:     resp.SocketType,
-		Uid:            resp.Uid,
-		UName:          resp.Uname,
-		TargetType:     resp.TargetType,
-		TargetId:       resp.TargetId,
-		TargetCid:      resp.TargetCid,
-		TargetUid:      resp.TargetUid,
-		TargetProtocol: resp.TargetProtocol,
-	}, nil
+func (s *Gateway) pack(data codec.DataPtr) (pbMsg []byte, jsonMsg []byte, err error) {
+	if pbMsg, err = s.dbp.Provider(codec.Proto).Pack(data); err != nil {
+		return
+	}
+	jsonMsg, err = s.dbp.Provider(codec.Json).Pack(data)
+	return
 }
 
-func (s *Gateway) SendFdMessage(gw string, fd int64, act codec.Action, data codec.DataPtr) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 1, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+func (s *Gateway) sendFdPacked(ctx context.Context, addr action.GatewayAddr, fd int64, act codec.Action, pbMsg, jsonMsg []byte) error {
+	return s.callCtx(ctx, OpMessage, false, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := messagev1.NewMessageServiceClient(cc)
 
-		var pbMsg []byte
-		var jsonMsg []byte
-		var err error
-		if pbMsg, err = s.dbp.Provider(codec.Proto).Pack(data); err != nil {
-			return err
-		}
-		if jsonMsg, err = s.dbp.Provider(codec.Json).Pack(data); err != nil {
-			return err
-		}
-
-		_, err = c.SendMessage(ctx, &messagev1.SendMessageRequest{
+		_, err := c.SendMessage(ctx, &messagev1.SendMessageRequest{
 			Target:      &messagev1.SendMessageRequest_Fd{Fd: fd},
 			ActionId:    uint32(act.Id),
 			ActionName:  act.Name,
@@ -246,13 +355,14 @@ func (s *Gateway) SendFdMessage(gw string, fd int64, act codec.Action, data code
 		})
 		return err
 	})
-
 }
 
 func (s *Gateway) SendIdMessage(gw string, id *messagev1.SendMessageRequest_BindId, act codec.Action, data codec.DataPtr) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 1, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	return s.SendIdMessageAt(action.ParseGatewayAddr(gw), id, act, data)
+}
+
+func (s *Gateway) SendIdMessageAt(addr action.GatewayAddr, id *messagev1.SendMessageRequest_BindId, act codec.Action, data codec.DataPtr) error {
+	return s.call(OpMessage, false, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := messagev1.NewMessageServiceClient(cc)
 
 		var pbMsg []byte
@@ -279,8 +389,17 @@ func (s *Gateway) SendIdMessage(gw string, id *messagev1.SendMessageRequest_Bind
 
 }
 
+// SendIdMessageAll send the message to the bound id on all gateways, the message is queued for the offline id when the outbox enabled,
+// the gateways are asked by BindExist before the send then
 func (s *Gateway) SendIdMessageAll(id *messagev1.SendMessageRequest_BindId, act codec.Action, data codec.DataPtr) (err error) {
-	for _, gw := range s.m.Get("gateway") {
+	if s.outbox != nil {
+		return s.SendIdMessageOrQueue(targetId(id), act, data, 0)
+	}
+	return s.sendIdMessageAll(id, act, data)
+}
+
+func (s *Gateway) sendIdMessageAll(id *messagev1.SendMessageRequest_BindId, act codec.Action, data codec.DataPtr) (err error) {
+	for _, gw := range s.Hosts() {
 		err = s.SendIdMessage(gw, id, act, data)
 		if err == nil {
 			return
@@ -291,9 +410,11 @@ func (s *Gateway) SendIdMessageAll(id *messagev1.SendMessageRequest_BindId, act
 }
 
 func (s *Gateway) JoinGroup(gw string, group, id string, fd int64) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 2, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	return s.JoinGroupAt(action.ParseGatewayAddr(gw), group, id, fd)
+}
+
+func (s *Gateway) JoinGroupAt(addr action.GatewayAddr, group, id string, fd int64) error {
+	err := s.call(OpGroup, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := groupv1.NewGroupServiceClient(cc)
 
 		_, err := c.JoinGroup(ctx, &groupv1.JoinGroupRequest{
@@ -305,13 +426,23 @@ func (s *Gateway) JoinGroup(gw string, group, id string, fd int64) error {
 		})
 		return err
 	})
+	if err == nil && s.conns != nil {
+		s.conns.Join(addr.Host, fd, group)
+	}
+	return err
+}
 
+// JoinGroupReq the request connection join the group
+func (s *Gateway) JoinGroupReq(req *action.HandlerReq, group, id string) error {
+	return s.JoinGroupAt(req.GatewayAddr(), group, id, req.Fd)
 }
 
 func (s *Gateway) LeaveGroup(gw string, group string, fd int64) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 2, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+	return s.LeaveGroupAt(action.ParseGatewayAddr(gw), group, fd)
+}
+
+func (s *Gateway) LeaveGroupAt(addr action.GatewayAddr, group string, fd int64) error {
+	err := s.call(OpGroup, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := groupv1.NewGroupServiceClient(cc)
 
 		_, err := c.LeaveGroup(ctx, &groupv1.LeaveGroupRequest{
@@ -320,26 +451,33 @@ func (s *Gateway) LeaveGroup(gw string, group string, fd int64) error {
 		})
 		return err
 	})
-
+	if err == nil && s.conns != nil {
+		s.conns.Leave(addr.Host, fd, group)
+	}
+	return err
 }
 
 func (s *Gateway) Broadcast(gw string, group string, act codec.Action, data codec.DataPtr, id string) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 2, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
-		c := groupv1.NewGroupServiceClient(cc)
+	return s.BroadcastAt(action.ParseGatewayAddr(gw), group, act, data, id)
+}
 
-		var pbMsg []byte
-		var jsonMsg []byte
-		var err error
-		if pbMsg, err = s.dbp.Provider(codec.Proto).Pack(data); err != nil {
-			return err
-		}
-		if jsonMsg, err = s.dbp.Provider(codec.Json).Pack(data); err != nil {
-			return err
-		}
+func (s *Gateway) BroadcastAt(addr action.GatewayAddr, group string, act codec.Action, data codec.DataPtr, id string) error {
+	pbMsg, jsonMsg, err := s.pack(data)
+	if err != nil {
+		return err
+	}
+	return s.broadcastPackedAt(addr, group, act, pbMsg, jsonMsg, id)
+}
+
+func (s *Gateway) broadcastPacked(gw string, group string, act codec.Action, pbMsg, jsonMsg []byte, id string) error {
+	return s.broadcastPackedAt(action.ParseGatewayAddr(gw), group, act, pbMsg, jsonMsg, id)
+}
 
-		_, err = c.BroadcastGroup(ctx, &groupv1.BroadcastGroupRequest{
+func (s *Gateway) broadcastPackedAt(addr action.GatewayAddr, group string, act codec.Action, pbMsg, jsonMsg []byte, id string) error {
+	return s.call(OpGroup, false, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
+		c := groupv1.NewGroupServiceClient(cc)
+
+		_, err := c.BroadcastGroup(ctx, &groupv1.BroadcastGroupRequest{
 			Group:       &groupv1.Group{Name: group},
 			ActionId:    uint32(act.Id),
 			ActionName:  act.Name,
@@ -349,32 +487,35 @@ func (s *Gateway) Broadcast(gw string, group string, act codec.Action, data code
 		})
 		return err
 	})
-
 }
 
+// BroadcastAll broadcast to the group on all gateways, use BroadcastGroups for the error
 func (s *Gateway) BroadcastAll(group string, act codec.Action, data codec.DataPtr, id string) {
-	var wg sync.WaitGroup
-	for _, gw := range s.m.Get("gateway") {
-		wg.Add(1)
-		go func(gw1 string) {
-			_ = s.Broadcast(gw1, group, act, data, id)
-			wg.Done()
-		}(gw)
+	var filter *BroadcastFilter
+	if id != "" {
+		filter = &BroadcastFilter{ExcludeIds: []string{id}}
 	}
-	wg.Wait()
+	_ = s.BroadcastGroups([]string{group}, act, data, filter)
+}
+
+func (s *Gateway) SetActionSlb(gw string, fd, actionId, slb int64) error {
+	return s.SetActionSlbAt(action.ParseGatewayAddr(gw), fd, actionId, slb)
 }
 
-func (s *Gateway) SetActionSlb(gw string, fd, action, slb int64) error {
-	var rqId string
-	gw, rqId = s.ParseRqId(gw)
-	return s.m.HostCall(s.ctx, gw, 0, s.id, "gateway", rqId, "", "", func(ctx context.Context, cc *grpc.ClientConn) error {
+func (s *Gateway) SetActionSlbAt(addr action.GatewayAddr, fd, actionId, slb int64) error {
+	gw := addr.Host
+	if err := s.call(OpSlb, true, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
 		c := slbv1.NewSlbServiceClient(cc)
 
 		_, err := c.SetActionSlb(ctx, &slbv1.ActionSlbRequest{
 			Fd:     fd,
-			Action: action,
+			Action: actionId,
 			Sbl:    slb,
 		})
 		return err
-	})
+	}); err != nil {
+		return err
+	}
+	s.slbs.set(connKey(gw, fd), actionId, action.Slb(slb))
+	return nil
 }
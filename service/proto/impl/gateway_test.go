@@ -0,0 +1,16 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"testing"
+)
+
+func TestGatewayChannelMismatch(t *testing.T) {
+	gw := NewGateway(context.Background(), "outer-test", nil, Channel("outer"))
+	addr := action.GatewayAddr{Host: "127.0.0.1:8001", Channel: "inner"}
+	if err := gw.UnBindIdAt(addr, 1, "uid"); !errors.Is(err, ErrChannelMismatch) {
+		t.Errorf("UnBindIdAt(%+v) err = %v, want %v", addr, err, ErrChannelMismatch)
+	}
+}
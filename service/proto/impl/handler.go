@@ -2,16 +2,21 @@ package impl
 
 import (
 	"context"
+	"errors"
 	handlerv1 "github.com/obnahsgnaw/socketapi/gen/handler/v1"
 	"github.com/obnahsgnaw/sockethandler/service/action"
 	"github.com/obnahsgnaw/socketutil/codec"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"sync"
 )
 
 type HandlerService struct {
 	manager             *ManagerProvider
 	dateBuilderProvider codec.DataBuilderProvider
+	forwarders          sync.Map // business channel => Forwarder
+	stats               forwardStats
+	inflight            Inflight
 	handlerv1.UnimplementedHandlerServiceServer
 }
 
@@ -30,10 +35,35 @@ func toCodecName(format string) codec.Name {
 	return codec.Proto
 }
 
+// authError convert the authorize error to the status error, the status errors of the policy are kept
+func authError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, action.ErrUnauthenticated) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return status.Error(codes.PermissionDenied, err.Error())
+}
+
+// Inflight return the in-flight counter of the requests of all the business channels, the forwarded ones included
+func (s *HandlerService) Inflight() *Inflight {
+	return &s.inflight
+}
+
 func (s *HandlerService) Handle(ctx context.Context, q *handlerv1.HandleRequest) (*handlerv1.HandleResponse, error) {
+	s.inflight.add()
+	defer s.inflight.done()
+	if resp, handled, err := s.forward(ctx, q); handled {
+		return resp, err
+	}
 	// fetch action handler
-	act, structure, handler, ok := s.manager.GetManager(q.BusinessChannel).GetHandler(codec.ActionId(q.ActionId))
+	m := s.manager.GetManager(q.BusinessChannel)
+	act, structure, handler, ok := m.GetHandler(codec.ActionId(q.ActionId))
 	if !ok {
+		if Forwarded(ctx) {
+			s.stats.unresolved.Add(1)
+		}
 		return nil, status.Error(codes.NotFound, "not found")
 	}
 	// unpack data
@@ -68,9 +98,19 @@ func (s *HandlerService) Handle(ctx context.Context, q *handlerv1.HandleRequest)
 			Protocol: q.Target.Protocol,
 		}
 	}
-	req := action.NewHandlerReq(q.Gateway, act, q.Fd, u, data, q.BindIds, target, toCodecName(q.Format), q.Package)
+	req := action.NewHandlerReq(q.Gateway, act, q.Fd, u, data, q.BindIds, target, toCodecName(q.Format), q.Package, action.Channel(q.BusinessChannel))
+
+	if err := m.CheckAttr(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := m.Authorize(ctx, req); err != nil {
+		return nil, authError(err)
+	}
+	if t := req.Tenant(); !t.Empty() {
+		ctx = action.WithTenant(ctx, t)
+	}
 
-	respAction, respData, err := handler(ctx, req)
+	respAction, respData, err := m.Wrap(handler)(ctx, req)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
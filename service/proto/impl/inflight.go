@@ -0,0 +1,55 @@
+package impl
+
+import (
+	"context"
+	"sync"
+)
+
+// Inflight count the requests being handled, the zero value is ready to use
+type Inflight struct {
+	sync.Mutex
+	n    int64
+	idle chan struct{} // closed when the count drops to 0, nil when no request in flight
+}
+
+func (f *Inflight) add() {
+	f.Lock()
+	defer f.Unlock()
+	if f.n == 0 {
+		f.idle = make(chan struct{})
+	}
+	f.n++
+}
+
+func (f *Inflight) done() {
+	f.Lock()
+	defer f.Unlock()
+	f.n--
+	if f.n == 0 {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// Count return the count of the requests being handled
+func (f *Inflight) Count() int64 {
+	f.Lock()
+	defer f.Unlock()
+	return f.n
+}
+
+// Wait wait the requests in flight done, return the context error when the context done first
+func (f *Inflight) Wait(ctx context.Context) error {
+	f.Lock()
+	idle := f.idle
+	f.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,39 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInflightWait(t *testing.T) {
+	var f Inflight
+	if err := f.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() with none in flight = %v, want nil", err)
+	}
+	f.add()
+	f.add()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() with %d in flight = %v, want %v", f.Count(), err, context.DeadlineExceeded)
+	}
+	done := make(chan error)
+	go func() {
+		done <- f.Wait(context.Background())
+	}()
+	f.done()
+	f.done()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Wait() not returned after the requests done")
+	}
+	if n := f.Count(); n != 0 {
+		t.Errorf("Count() = %d, want 0", n)
+	}
+}
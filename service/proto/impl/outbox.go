@@ -0,0 +1,247 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bindv1 "github.com/obnahsgnaw/socketapi/gen/bind/v1"
+	messagev1 "github.com/obnahsgnaw/socketapi/gen/message/v1"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/outbox"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"google.golang.org/grpc"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoOutbox the outbox is not enabled by the Outbox option
+	ErrNoOutbox = errors.New("gateway outbox not enabled")
+	// ErrOutboxDropped the queued messages are dropped for the max size or the ttl
+	ErrOutboxDropped = errors.New("gateway outbox messages dropped")
+)
+
+// OutboxListener listen the outbox errors of the bound id, such as the dropped messages and the failed deliveries
+type OutboxListener func(id *bindv1.Id, err error)
+
+type outboxConfig struct {
+	sync.Mutex
+	store   outbox.Store
+	maxSize int
+	ttl     time.Duration
+	flush   time.Duration
+	queued  map[string]*bindv1.Id // the ids queued by this gateway object, bindKey => id
+	started bool
+}
+
+// Outbox enable the store-and-forward of the bound id messages, maxSize limit the queue size of a bound id, ttl is the default message ttl.
+// The queued messages are delivered to the fd when the id is bound by BindIdAt of this gateway object, to the bound id of a joining
+// gateway host, and to the bound id of all the hosts every OutboxFlush interval, only the ids queued by this gateway object are flushed
+// by the host joining and the interval. SendIdMessageAll asks the gateways by BindExist before every send to queue for the offline ids,
+// use SendIdMessage to send without the check
+func Outbox(store outbox.Store, maxSize int, ttl time.Duration) GatewayOption {
+	return func(s *Gateway) {
+		if store != nil {
+			s.outbox = &outboxConfig{store: store, maxSize: maxSize, ttl: ttl, queued: make(map[string]*bindv1.Id)}
+		}
+	}
+}
+
+// OutboxFlush set the interval retrying the delivery of the queued messages to the bound ids of all the gateway hosts, 0 to disable,
+// it should be applied after the Outbox option
+func OutboxFlush(interval time.Duration) GatewayOption {
+	return func(s *Gateway) {
+		if s.outbox != nil {
+			s.outbox.flush = interval
+		}
+	}
+}
+
+// OnOutboxError listen the outbox errors
+func OnOutboxError(l OutboxListener) GatewayOption {
+	return func(s *Gateway) {
+		if l != nil {
+			s.outboxListeners = append(s.outboxListeners, l)
+		}
+	}
+}
+
+func (s *Gateway) reportOutbox(id *bindv1.Id, err error) {
+	for _, l := range s.outboxListeners {
+		l(id, err)
+	}
+}
+
+func bindKey(typ, id string) string {
+	return typ + ":" + id
+}
+
+// idTarget return the message target of the bound id
+func idTarget(id *bindv1.Id) *messagev1.SendMessageRequest_BindId {
+	return &messagev1.SendMessageRequest_BindId{Type: id.Typ, Id: id.Id}
+}
+
+// targetId return the bound id of the message target
+func targetId(target *messagev1.SendMessageRequest_BindId) *bindv1.Id {
+	return &bindv1.Id{Typ: target.Type, Id: target.Id}
+}
+
+// QueueIdMessage queue the message for the bound id, the message is delivered when the id is bound next time as described by Outbox, ttl <= 0 use the default ttl
+func (s *Gateway) QueueIdMessage(id *bindv1.Id, act codec.Action, data codec.DataPtr, ttl time.Duration) error {
+	if s.outbox == nil {
+		return ErrNoOutbox
+	}
+	pbMsg, jsonMsg, err := s.pack(data)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		ttl = s.outbox.ttl
+	}
+	msg := outbox.Message{Action: act, PbMessage: pbMsg, JsonMessage: jsonMsg}
+	if ttl > 0 {
+		msg.ExpireAt = time.Now().Add(ttl)
+	}
+	return s.queue(id, msg)
+}
+
+// queue push the message and track the id for the flushes
+func (s *Gateway) queue(id *bindv1.Id, msg outbox.Message) error {
+	dropped, err := s.outbox.store.Push(bindKey(id.Typ, id.Id), msg, s.outbox.maxSize)
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		s.reportOutbox(id, fmt.Errorf("%w: %d", ErrOutboxDropped, dropped))
+	}
+	s.outbox.Lock()
+	s.outbox.queued[bindKey(id.Typ, id.Id)] = id
+	if s.outbox.flush > 0 && !s.outbox.started {
+		s.outbox.started = true
+		go s.flushLoop()
+	}
+	s.outbox.Unlock()
+	return nil
+}
+
+// SendIdMessageOrQueue send the message to the bound id on all gateways, the message is queued when the id is not connected
+func (s *Gateway) SendIdMessageOrQueue(id *bindv1.Id, act codec.Action, data codec.DataPtr, ttl time.Duration) error {
+	exist, err := s.BindExistAll(id.Id, id.Typ)
+	if err != nil {
+		return err
+	}
+	if exist {
+		if err = s.sendIdMessageAll(idTarget(id), act, data); err == nil {
+			return nil
+		}
+	}
+	return s.QueueIdMessage(id, act, data, ttl)
+}
+
+// QueuedLen return the queued message count of the bound id
+func (s *Gateway) QueuedLen(id *bindv1.Id) (int, error) {
+	if s.outbox == nil {
+		return 0, ErrNoOutbox
+	}
+	return s.outbox.store.Len(bindKey(id.Typ, id.Id))
+}
+
+// deliverQueued deliver the queued messages of the bound ids to the fd in order
+func (s *Gateway) deliverQueued(addr action.GatewayAddr, fd int64, ids []*bindv1.Id) {
+	if s.outbox == nil {
+		return
+	}
+	for _, id := range ids {
+		s.redeliver(id, func(msg outbox.Message) error {
+			return s.sendFdPacked(s.ctx, addr, fd, msg.Action, msg.PbMessage, msg.JsonMessage)
+		})
+	}
+}
+
+// FlushQueued deliver the queued messages of the ids queued by this gateway object to the ids bound on the gateway host,
+// such as the host joined, the errors are reported to the outbox listeners
+func (s *Gateway) FlushQueued(host string) {
+	if s.outbox == nil {
+		return
+	}
+	addr := action.GatewayAddr{Host: host}
+	s.outbox.Lock()
+	ids := make([]*bindv1.Id, 0, len(s.outbox.queued))
+	for _, id := range s.outbox.queued {
+		ids = append(ids, id)
+	}
+	s.outbox.Unlock()
+	for _, id := range ids {
+		exist, err := s.BindExistAt(addr, id.Id, id.Typ)
+		if err != nil {
+			s.reportOutbox(id, err)
+			continue
+		}
+		if !exist {
+			continue
+		}
+		target := idTarget(id)
+		s.redeliver(id, func(msg outbox.Message) error {
+			return s.sendIdPacked(addr, target, msg.Action, msg.PbMessage, msg.JsonMessage)
+		})
+	}
+}
+
+func (s *Gateway) flushLoop() {
+	ticker := time.NewTicker(s.outbox.flush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			for _, host := range s.Hosts() {
+				s.FlushQueued(host)
+			}
+		}
+	}
+}
+
+// redeliver send the queued messages of the bound id in order, the undelivered messages are put back to the front,
+// the id is forgotten when its queue is empty, the errors are reported to the outbox listeners
+func (s *Gateway) redeliver(id *bindv1.Id, send func(msg outbox.Message) error) {
+	key := bindKey(id.Typ, id.Id)
+	list, err := s.outbox.store.Pop(key)
+	if err != nil {
+		s.reportOutbox(id, err)
+		return
+	}
+	now := time.Now()
+	for i, msg := range list {
+		if msg.Expired(now) {
+			continue
+		}
+		if err = send(msg); err != nil {
+			s.reportOutbox(id, err)
+			if err = s.outbox.store.Requeue(key, list[i:]); err != nil {
+				s.reportOutbox(id, err)
+			}
+			return
+		}
+	}
+	s.outbox.Lock()
+	defer s.outbox.Unlock()
+	if n, err := s.outbox.store.Len(key); err == nil && n == 0 {
+		delete(s.outbox.queued, key)
+	}
+}
+
+func (s *Gateway) sendIdPacked(addr action.GatewayAddr, id *messagev1.SendMessageRequest_BindId, act codec.Action, pbMsg, jsonMsg []byte) error {
+	return s.call(OpMessage, false, addr, func(ctx context.Context, cc *grpc.ClientConn) error {
+		c := messagev1.NewMessageServiceClient(cc)
+
+		_, err := c.SendMessage(ctx, &messagev1.SendMessageRequest{
+			Target:      &messagev1.SendMessageRequest_Id{Id: id},
+			ActionId:    uint32(act.Id),
+			ActionName:  act.Name,
+			JsonMessage: jsonMsg,
+			PbMessage:   pbMsg,
+		})
+		return err
+	})
+}
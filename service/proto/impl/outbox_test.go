@@ -0,0 +1,52 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	bindv1 "github.com/obnahsgnaw/socketapi/gen/bind/v1"
+	"github.com/obnahsgnaw/sockethandler/service/outbox"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"testing"
+	"time"
+)
+
+func TestGatewayOutboxRedeliver(t *testing.T) {
+	down := errors.New("down")
+	tests := []struct {
+		name    string
+		failAt  int
+		sent    int
+		queued  int
+		tracked bool
+	}{
+		{"delivered", -1, 3, 0, false},
+		{"first failed", 0, 0, 3, true},
+		{"last failed", 2, 2, 1, true},
+	}
+	for _, tt := range tests {
+		gw := NewGateway(context.Background(), "outbox-test", nil, Outbox(outbox.NewMemoryStore(), 10, time.Minute))
+		id := &bindv1.Id{Typ: "uid", Id: "7"}
+		for i := 0; i < 3; i++ {
+			if err := gw.queue(id, outbox.Message{Action: codec.Action{Id: codec.ActionId(i + 1)}}); err != nil {
+				t.Fatalf("%s: queue() = %v", tt.name, err)
+			}
+		}
+		sent := 0
+		gw.redeliver(id, func(msg outbox.Message) error {
+			if sent == tt.failAt {
+				return down
+			}
+			sent++
+			return nil
+		})
+		if sent != tt.sent {
+			t.Errorf("%s: sent %d, want %d", tt.name, sent, tt.sent)
+		}
+		if n, _ := gw.QueuedLen(id); n != tt.queued {
+			t.Errorf("%s: QueuedLen() = %d, want %d", tt.name, n, tt.queued)
+		}
+		if _, ok := gw.outbox.queued[bindKey(id.Typ, id.Id)]; ok != tt.tracked {
+			t.Errorf("%s: id tracked = %v, want %v", tt.name, ok, tt.tracked)
+		}
+	}
+}
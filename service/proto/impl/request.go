@@ -0,0 +1,66 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNoReplyManager the reply action manager is not set by the ReplyManager option
+	ErrNoReplyManager = errors.New("gateway reply manager not set")
+	// ErrRequestTimeout the device did not reply in time
+	ErrRequestTimeout = errors.New("gateway request timeout")
+)
+
+// DefaultRequestTimeout the request timeout when the context has no deadline
+const DefaultRequestTimeout = 10 * time.Second
+
+// ReplyManager set the action manager which the reply actions are listened on
+func ReplyManager(m *action.Manager) GatewayOption {
+	return func(s *Gateway) {
+		s.replies = m
+	}
+}
+
+// Request send the action to the connection and wait for the reply action,
+// when the data implements SeqData a sequence number is assigned and the reply is correlated by it, otherwise only one request
+// of the same reply action can wait on a connection at the same time. The reply action must be listened by Handler.ListenReply.
+// The sending uses the context, and the reply is only received when the gateway routes it to this handler instance,
+// so with several instances the connection should be pinned to the instance such as by Handler.PinModuleToSelf
+func (s *Gateway) Request(ctx context.Context, gw string, fd int64, act codec.Action, data codec.DataPtr, replyAction codec.Action) (*action.HandlerReq, error) {
+	if s.replies == nil {
+		return nil, ErrNoReplyManager
+	}
+	addr := action.ParseGatewayAddr(gw)
+	var seq uint64
+	if sd, ok := data.(SeqData); ok {
+		seq = atomic.AddUint64(&s.reqSeq, 1)
+		sd.SetSeq(seq)
+	}
+	reply, cancel, err := s.replies.Await(action.ReplyKey(addr.Host, fd, replyAction.Id, seq))
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancelTimeout()
+	}
+	if err = s.SendFdMessageCtx(ctx, addr, fd, act, data); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrRequestTimeout
+		}
+		return nil, ctx.Err()
+	case req := <-reply:
+		return req, nil
+	}
+}
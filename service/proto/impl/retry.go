@@ -0,0 +1,159 @@
+package impl
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// OpClass the operation class of the gateway rpc calls
+type OpClass string
+
+const (
+	OpBind    OpClass = "bind"
+	OpConn    OpClass = "conn"
+	OpMessage OpClass = "message"
+	OpGroup   OpClass = "group"
+	OpSlb     OpClass = "slb"
+)
+
+// priority the call priority passed to the rpc client manager
+func (c OpClass) priority() int {
+	switch c {
+	case OpMessage:
+		return 1
+	case OpGroup:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// RetryPolicy the retry policy of an operation class
+type RetryPolicy struct {
+	MaxAttempts        int           // the max attempts include the first call, <= 1 means no retry
+	InitialBackoff     time.Duration // the backoff before the first retry
+	MaxBackoff         time.Duration // the max backoff, 0 means no limit
+	Multiplier         float64       // the backoff multiplier, default 2
+	Jitter             float64       // the random jitter ratio of the backoff in [0, 1]
+	RetryNonIdempotent bool          // retry the non-idempotent calls such as message sending and broadcasting
+	Retryable          func(err error) bool
+}
+
+// DefaultRetryPolicy return a policy retrying the transient errors 3 times with exponential backoff
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// IsTransient return if the error is a transient gateway error, such as a restarting gateway
+func IsTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *RetryPolicy) retry(attempt int, idempotent bool, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if !idempotent && !p.RetryNonIdempotent {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d = d * (1 - p.Jitter + 2*p.Jitter*rand.Float64())
+	}
+	return time.Duration(d)
+}
+
+// RetryBudget limit the retries to avoid the retry storm, each failure cost a token and each success return ratio tokens,
+// retries are allowed only when more than half of the tokens left
+type RetryBudget struct {
+	sync.Mutex
+	max    float64
+	tokens float64
+	ratio  float64
+}
+
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	return &RetryBudget{max: maxTokens, tokens: maxTokens, ratio: ratio}
+}
+
+func (b *RetryBudget) success() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.tokens = math.Min(b.max, b.tokens+b.ratio)
+}
+
+func (b *RetryBudget) failure() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.tokens = math.Max(0, b.tokens-1)
+}
+
+func (b *RetryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	return b.tokens > b.max/2
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// RetryPolicyOf set the retry policy of the operation class
+func RetryPolicyOf(op OpClass, p *RetryPolicy) GatewayOption {
+	return func(s *Gateway) {
+		s.retries[op] = p
+	}
+}
+
+// RetryBudgetOf set the retry budget shared by all the operation classes
+func RetryBudgetOf(b *RetryBudget) GatewayOption {
+	return func(s *Gateway) {
+		s.budget = b
+	}
+}
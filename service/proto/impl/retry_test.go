@@ -0,0 +1,87 @@
+package impl
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"first", RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2}, 1, 100 * time.Millisecond},
+		{"third", RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2}, 3, 400 * time.Millisecond},
+		{"default multiplier", RetryPolicy{InitialBackoff: 100 * time.Millisecond}, 2, 200 * time.Millisecond},
+		{"multiplier 3", RetryPolicy{InitialBackoff: 10 * time.Millisecond, Multiplier: 3}, 3, 90 * time.Millisecond},
+		{"capped", RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 250 * time.Millisecond}, 5, 250 * time.Millisecond},
+		{"no cap", RetryPolicy{InitialBackoff: time.Second}, 4, 8 * time.Second},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.backoff(c.attempt); got != c.want {
+				t.Errorf("backoff(%d) = %v, want %v", c.attempt, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 80*time.Millisecond || got > 120*time.Millisecond {
+			t.Fatalf("backoff(1) = %v, want in [80ms, 120ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "gateway restarting")
+	internal := status.Error(codes.Internal, "failed")
+	cases := []struct {
+		name       string
+		policy     *RetryPolicy
+		attempt    int
+		idempotent bool
+		err        error
+		want       bool
+	}{
+		{"nil policy", nil, 1, true, unavailable, false},
+		{"transient", &RetryPolicy{MaxAttempts: 3}, 1, true, unavailable, true},
+		{"not transient", &RetryPolicy{MaxAttempts: 3}, 1, true, internal, false},
+		{"attempts used", &RetryPolicy{MaxAttempts: 3}, 3, true, unavailable, false},
+		{"non idempotent", &RetryPolicy{MaxAttempts: 3}, 1, false, unavailable, false},
+		{"non idempotent allowed", &RetryPolicy{MaxAttempts: 3, RetryNonIdempotent: true}, 1, false, unavailable, true},
+		{"custom retryable", &RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool { return true }}, 1, true, errors.New("x"), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.retry(c.attempt, c.idempotent, c.err); got != c.want {
+				t.Errorf("retry = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(10, 0.5)
+	for i := 0; i < 5; i++ {
+		b.failure()
+	}
+	if b.allow() {
+		t.Fatal("allow() = true with half of the tokens left, want false")
+	}
+	b.success()
+	if !b.allow() {
+		t.Fatal("allow() = false after a success, want true")
+	}
+	var nilBudget *RetryBudget
+	if !nilBudget.allow() {
+		t.Fatal("nil budget allow() = false, want true")
+	}
+}
@@ -0,0 +1,142 @@
+package impl
+
+import (
+	"github.com/obnahsgnaw/sockethandler/internal/fanout"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"sync"
+)
+
+// slbs the action slb set on the connections by this handler, connKey => action id => slb
+type slbs struct {
+	sync.RWMutex
+	m map[string]map[int64]action.Slb
+}
+
+func newSlbs() *slbs {
+	return &slbs{m: make(map[string]map[int64]action.Slb)}
+}
+
+// set cache the slb of the action, SlbDefault clears the entry so that the sticky policy applies again
+func (s *slbs) set(key string, actionId int64, slb action.Slb) {
+	s.Lock()
+	defer s.Unlock()
+	if slb == action.SlbDefault {
+		delete(s.m[key], actionId)
+		if len(s.m[key]) == 0 {
+			delete(s.m, key)
+		}
+		return
+	}
+	if _, ok := s.m[key]; !ok {
+		s.m[key] = make(map[int64]action.Slb)
+	}
+	s.m[key][actionId] = slb
+}
+
+// reserve mark the slb of the action pending if none set or pending, return false otherwise
+func (s *slbs) reserve(key string, actionId int64, slb action.Slb) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.m[key][actionId]; ok {
+		return false
+	}
+	if _, ok := s.m[key]; !ok {
+		s.m[key] = make(map[int64]action.Slb)
+	}
+	s.m[key][actionId] = slb
+	return true
+}
+
+// release roll back the pending slb of the action, kept if replaced meanwhile
+func (s *slbs) release(key string, actionId int64, slb action.Slb) {
+	s.Lock()
+	defer s.Unlock()
+	if cur, ok := s.m[key][actionId]; ok && cur == slb {
+		delete(s.m[key], actionId)
+		if len(s.m[key]) == 0 {
+			delete(s.m, key)
+		}
+	}
+}
+
+func (s *slbs) get(key string, actionId int64) (action.Slb, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	slb, ok := s.m[key][actionId]
+	return slb, ok
+}
+
+func (s *slbs) drop(key string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.m, key)
+}
+
+func (s *slbs) all(key string) map[codec.ActionId]action.Slb {
+	s.RLock()
+	defer s.RUnlock()
+	list := make(map[codec.ActionId]action.Slb, len(s.m[key]))
+	for id, slb := range s.m[key] {
+		list[codec.ActionId(id)] = slb
+	}
+	return list
+}
+
+// DropSlb forget the action slb set on the connection, such as the connection closed
+func (s *Gateway) DropSlb(gw string, fd int64) {
+	s.slbs.drop(connKey(action.ParseGatewayAddr(gw).Host, fd))
+}
+
+// ActionSlbSet return the slb set or being set on the connection for the action by this handler
+func (s *Gateway) ActionSlbSet(gw string, fd, actionId int64) (action.Slb, bool) {
+	return s.slbs.get(connKey(action.ParseGatewayAddr(gw).Host, fd), actionId)
+}
+
+// StickActionSlbAt mark the slb of the connection action pending if none set or pending by this handler, and return the call
+// setting it on the gateway, nil if already set or pending, the pending mark is rolled back when the call failed
+func (s *Gateway) StickActionSlbAt(addr action.GatewayAddr, fd, actionId int64, slb action.Slb) func() error {
+	key := connKey(addr.Host, fd)
+	if !s.slbs.reserve(key, actionId, slb) {
+		return nil
+	}
+	return func() error {
+		err := s.SetActionSlbAt(addr, fd, actionId, int64(slb))
+		if err != nil {
+			s.slbs.release(key, actionId, slb)
+		}
+		return err
+	}
+}
+
+// PinActions set the slb of the connection actions, the actions of the connection go to the server selected by the slb, return the last error
+func (s *Gateway) PinActions(gw string, fd int64, slb action.Slb, acts ...codec.ActionId) error {
+	return s.PinActionsAt(action.ParseGatewayAddr(gw), fd, slb, acts...)
+}
+
+// PinActionsAt set the slb of the connection actions concurrently, the slb service sets one action per call
+func (s *Gateway) PinActionsAt(addr action.GatewayAddr, fd int64, slb action.Slb, acts ...codec.ActionId) error {
+	return fanout.Run(len(acts), func(i int) error {
+		return s.SetActionSlbAt(addr, fd, int64(acts[i]), int64(slb))
+	})
+}
+
+// LocalPinnedActions return the actions pinned on the connection by this handler instance, action => slb,
+// the gateway can not be queried, the pins set by the other instances or lost by a gateway restart are not known
+func (s *Gateway) LocalPinnedActions(gw string, fd int64) map[codec.ActionId]action.Slb {
+	return s.slbs.all(connKey(action.ParseGatewayAddr(gw).Host, fd))
+}
+
+// UnpinActions restore the gateway default load balancing of the connection actions, all the locally pinned actions if none given
+func (s *Gateway) UnpinActions(gw string, fd int64, acts ...codec.ActionId) error {
+	return s.UnpinActionsAt(action.ParseGatewayAddr(gw), fd, acts...)
+}
+
+func (s *Gateway) UnpinActionsAt(addr action.GatewayAddr, fd int64, acts ...codec.ActionId) error {
+	if len(acts) == 0 {
+		for act := range s.slbs.all(connKey(addr.Host, fd)) {
+			acts = append(acts, act)
+		}
+	}
+	return s.PinActionsAt(addr, fd, action.SlbDefault, acts...)
+}
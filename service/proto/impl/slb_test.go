@@ -0,0 +1,65 @@
+package impl
+
+import (
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"reflect"
+	"testing"
+)
+
+func TestSlbsLocalPins(t *testing.T) {
+	tests := []struct {
+		name string
+		set  map[int64]action.Slb
+		want map[codec.ActionId]action.Slb
+	}{
+		{"none", nil, map[codec.ActionId]action.Slb{}},
+		{"pinned", map[int64]action.Slb{1: 5, 2: 5}, map[codec.ActionId]action.Slb{1: 5, 2: 5}},
+		{"cleared", map[int64]action.Slb{1: 5, 2: action.SlbDefault}, map[codec.ActionId]action.Slb{1: 5}},
+	}
+	for _, tt := range tests {
+		s := newSlbs()
+		for act, slb := range tt.set {
+			s.set(connKey("gw", 1), act, slb)
+		}
+		s.set(connKey("gw", 2), 3, 9)
+		if got := s.all(connKey("gw", 1)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: all() = %v, want %v", tt.name, got, tt.want)
+		}
+		s.drop(connKey("gw", 1))
+		if got := s.all(connKey("gw", 1)); len(got) != 0 {
+			t.Errorf("%s: all() after drop = %v, want none", tt.name, got)
+		}
+		if _, ok := s.get(connKey("gw", 2), 3); !ok {
+			t.Errorf("%s: the other connection dropped", tt.name)
+		}
+	}
+}
+
+func TestSlbsReserve(t *testing.T) {
+	key := connKey("gw", 1)
+	s := newSlbs()
+	if !s.reserve(key, 1, 5) {
+		t.Fatal("reserve() = false on an empty entry")
+	}
+	if s.reserve(key, 1, 5) {
+		t.Error("reserve() = true on a pending entry")
+	}
+	s.release(key, 1, 5)
+	if _, ok := s.get(key, 1); ok {
+		t.Error("release() kept the pending entry")
+	}
+	s.reserve(key, 1, 5)
+	s.set(key, 1, 7)
+	s.release(key, 1, 5)
+	if slb, _ := s.get(key, 1); slb != 7 {
+		t.Errorf("release() rolled back a replaced entry, got %v", slb)
+	}
+	s.set(key, 1, action.SlbDefault)
+	if _, ok := s.get(key, 1); ok {
+		t.Error("set() with SlbDefault kept the entry")
+	}
+	if !s.reserve(key, 1, 5) {
+		t.Error("reserve() = false after unpinned")
+	}
+}
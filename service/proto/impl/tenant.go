@@ -0,0 +1,73 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/socketutil/codec"
+)
+
+var (
+	// ErrTenantMismatch the target connection belongs to another tenant
+	ErrTenantMismatch = errors.New("gateway tenant mismatch")
+	// ErrTenantUnknown the tenant of the target connection is unknown to this handler instance, only returned by the strict check
+	ErrTenantUnknown = errors.New("gateway tenant unknown")
+)
+
+// StrictTenant reject the connections unknown to the connection registry in the tenant check, by default they are allowed
+// because the connections handled by the other instances are not tracked
+func StrictTenant() GatewayOption {
+	return func(s *Gateway) {
+		s.strictTenant = true
+	}
+}
+
+// JoinTenantGroup the request connection join the group of the request tenant
+func (s *Gateway) JoinTenantGroup(req *action.HandlerReq, group, id string) error {
+	return s.JoinGroupReq(req, req.Tenant().Group(group), id)
+}
+
+// LeaveTenantGroup the connection leave the group of the tenant
+func (s *Gateway) LeaveTenantGroup(t action.Tenant, gw string, group string, fd int64) error {
+	return s.LeaveGroup(gw, t.Group(group), fd)
+}
+
+// BroadcastTenantAll broadcast to the group of the tenant on all gateways
+func (s *Gateway) BroadcastTenantAll(t action.Tenant, group string, act codec.Action, data codec.DataPtr, id string) {
+	s.BroadcastAll(t.Group(group), act, data, id)
+}
+
+// CheckTenant check the connection belongs to the tenant of the context, the connection is looked up in the connection registry,
+// the context without a tenant is not checked, the connections unknown to the registry are allowed unless StrictTenant set
+func (s *Gateway) CheckTenant(ctx context.Context, gw string, fd int64) error {
+	return s.checkTenantAt(ctx, action.ParseGatewayAddr(gw), fd)
+}
+
+func (s *Gateway) checkTenantAt(ctx context.Context, addr action.GatewayAddr, fd int64) error {
+	t, ok := action.TenantFrom(ctx)
+	if !ok || t.Empty() {
+		return nil
+	}
+	if s.conns == nil {
+		if s.strictTenant {
+			return ErrNoConnRegistry
+		}
+		return nil
+	}
+	c, ok := s.conns.Get(addr.Host, fd)
+	if !ok || c.User == nil {
+		if s.strictTenant {
+			return ErrTenantUnknown
+		}
+		return nil
+	}
+	if !c.User.Tenant().Same(t) {
+		return ErrTenantMismatch
+	}
+	return nil
+}
+
+// SendTenantFdMessage send the message to the connection only when it belongs to the tenant of the context, same as SendFdMessageCtx
+func (s *Gateway) SendTenantFdMessage(ctx context.Context, gw string, fd int64, act codec.Action, data codec.DataPtr) error {
+	return s.SendFdMessageCtx(ctx, action.ParseGatewayAddr(gw), fd, act, data)
+}
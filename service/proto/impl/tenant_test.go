@@ -0,0 +1,40 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"github.com/obnahsgnaw/sockethandler/service/action"
+	"github.com/obnahsgnaw/sockethandler/service/conn"
+	"github.com/obnahsgnaw/socketutil/codec"
+	"testing"
+)
+
+func TestGatewayCheckTenant(t *testing.T) {
+	reg := conn.NewRegistry()
+	reg.Touch(action.NewHandlerReq("gw1", codec.Action{Id: 1}, 1, &action.User{Id: 1, Attr: map[string]string{"company_id": "5"}}, nil, nil, nil, "", nil))
+	reg.Touch(action.NewHandlerReq("gw1", codec.Action{Id: 1}, 2, &action.User{Id: 2, Attr: map[string]string{"company_no": "5"}}, nil, nil, nil, "", nil))
+	ctx := action.WithTenant(context.Background(), action.Tenant{Cid: 5})
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		fd     int64
+		strict bool
+		want   error
+	}{
+		{"same tenant", ctx, 1, false, nil},
+		{"other tenant", ctx, 2, false, ErrTenantMismatch},
+		{"unknown", ctx, 3, false, nil},
+		{"unknown strict", ctx, 3, true, ErrTenantUnknown},
+		{"no tenant", context.Background(), 2, true, nil},
+	}
+	for _, tt := range tests {
+		o := []GatewayOption{ConnRegistry(reg)}
+		if tt.strict {
+			o = append(o, StrictTenant())
+		}
+		gw := NewGateway(context.Background(), "tenant-test", nil, o...)
+		if err := gw.CheckTenant(tt.ctx, "gw1", tt.fd); !errors.Is(err, tt.want) {
+			t.Errorf("%s: CheckTenant() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
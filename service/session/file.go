@@ -0,0 +1,82 @@
+package session
+
+import (
+	"github.com/obnahsgnaw/sockethandler/internal/filekv"
+	"sync"
+)
+
+// FileStore keep the sessions in json files of the dir, one file per session, for tests and single instance deployments
+type FileStore struct {
+	sync.Mutex
+	dir *filekv.Dir
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	d, err := filekv.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: d}, nil
+}
+
+func (s *FileStore) load(sid string) (map[string]string, error) {
+	values := make(map[string]string)
+	if _, err := s.dir.Load(sid, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (s *FileStore) save(sid string, values map[string]string) error {
+	if len(values) == 0 {
+		return s.dir.Remove(sid)
+	}
+	return s.dir.Save(sid, values)
+}
+
+func (s *FileStore) Get(sid, key string) (string, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	values, err := s.load(sid)
+	if err != nil {
+		return "", false, err
+	}
+	v, ok := values[key]
+	return v, ok, nil
+}
+
+func (s *FileStore) Set(sid, key, val string) error {
+	s.Lock()
+	defer s.Unlock()
+	values, err := s.load(sid)
+	if err != nil {
+		return err
+	}
+	values[key] = val
+	return s.save(sid, values)
+}
+
+func (s *FileStore) Del(sid string, keys ...string) error {
+	s.Lock()
+	defer s.Unlock()
+	values, err := s.load(sid)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		delete(values, k)
+	}
+	return s.save(sid, values)
+}
+
+func (s *FileStore) All(sid string) (map[string]string, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.load(sid)
+}
+
+func (s *FileStore) Clear(sid string) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.save(sid, nil)
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	values   map[string]string
+	expireAt time.Time
+}
+
+// MemoryStore keep the sessions in memory, the sessions not accessed within the ttl are expired, ttl <= 0 means never expire
+type MemoryStore struct {
+	sync.Mutex
+	ttl       time.Duration
+	sessions  map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, sessions: make(map[string]*memoryEntry), lastSweep: time.Now()}
+}
+
+// entry return the alive session and refresh its expiration, create it if needed
+func (s *MemoryStore) entry(sid string, create bool) *memoryEntry {
+	now := time.Now()
+	s.sweep(now)
+	e, ok := s.sessions[sid]
+	if ok && s.ttl > 0 && now.After(e.expireAt) {
+		delete(s.sessions, sid)
+		ok = false
+	}
+	if !ok {
+		if !create {
+			return nil
+		}
+		e = &memoryEntry{values: make(map[string]string)}
+		s.sessions[sid] = e
+	}
+	if s.ttl > 0 {
+		e.expireAt = now.Add(s.ttl)
+	}
+	return e
+}
+
+// sweep remove the expired sessions at most once a ttl
+func (s *MemoryStore) sweep(now time.Time) {
+	if s.ttl <= 0 || now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for sid, e := range s.sessions {
+		if now.After(e.expireAt) {
+			delete(s.sessions, sid)
+		}
+	}
+}
+
+func (s *MemoryStore) Get(sid, key string) (string, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if e := s.entry(sid, false); e != nil {
+		v, ok := e.values[key]
+		return v, ok, nil
+	}
+	return "", false, nil
+}
+
+func (s *MemoryStore) Set(sid, key, val string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.entry(sid, true).values[key] = val
+	return nil
+}
+
+func (s *MemoryStore) Del(sid string, keys ...string) error {
+	s.Lock()
+	defer s.Unlock()
+	if e := s.entry(sid, false); e != nil {
+		for _, k := range keys {
+			delete(e.values, k)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) All(sid string) (map[string]string, error) {
+	s.Lock()
+	defer s.Unlock()
+	values := make(map[string]string)
+	if e := s.entry(sid, false); e != nil {
+		for k, v := range e.values {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+func (s *MemoryStore) Clear(sid string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.sessions, sid)
+	return nil
+}
@@ -0,0 +1,118 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrNoStore the session store is not enabled
+var ErrNoStore = errors.New("session store not enabled")
+
+// Store the session store, all the methods must be safe for concurrent use
+type Store interface {
+	Get(sid, key string) (string, bool, error)
+	Set(sid, key, val string) error
+	Del(sid string, keys ...string) error
+	All(sid string) (map[string]string, error)
+	Clear(sid string) error
+}
+
+// Manager provide the sessions of the connections and the bound ids
+type Manager struct {
+	store Store
+}
+
+func NewManager(store Store) *Manager {
+	return &Manager{store: store}
+}
+
+func (m *Manager) Store() Store {
+	return m.store
+}
+
+// ConnSid the session id of the gateway connection
+func ConnSid(gateway string, fd int64) string {
+	return "conn:" + gateway + "#" + strconv.FormatInt(fd, 10)
+}
+
+// BindSid the session id of the bound id
+func BindSid(typ, id string) string {
+	return "bind:" + typ + ":" + id
+}
+
+// Conn return the session of the gateway connection
+func (m *Manager) Conn(gateway string, fd int64) *Session {
+	return &Session{id: ConnSid(gateway, fd), store: m.store}
+}
+
+// Bind return the session of the bound id, shared by the connections bound with the id
+func (m *Manager) Bind(typ, id string) *Session {
+	return &Session{id: BindSid(typ, id), store: m.store}
+}
+
+// Session the key value session, a nil session returns ErrNoStore
+type Session struct {
+	id    string
+	store Store
+}
+
+func (s *Session) Id() string {
+	if s == nil {
+		return ""
+	}
+	return s.id
+}
+
+func (s *Session) Get(key string) (string, bool, error) {
+	if s == nil {
+		return "", false, ErrNoStore
+	}
+	return s.store.Get(s.id, key)
+}
+
+func (s *Session) Set(key, val string) error {
+	if s == nil {
+		return ErrNoStore
+	}
+	return s.store.Set(s.id, key, val)
+}
+
+func (s *Session) Del(keys ...string) error {
+	if s == nil {
+		return ErrNoStore
+	}
+	return s.store.Del(s.id, keys...)
+}
+
+func (s *Session) All() (map[string]string, error) {
+	if s == nil {
+		return nil, ErrNoStore
+	}
+	return s.store.All(s.id)
+}
+
+func (s *Session) Clear() error {
+	if s == nil {
+		return ErrNoStore
+	}
+	return s.store.Clear(s.id)
+}
+
+// Load decode the json value of the key into v
+func (s *Session) Load(key string, v interface{}) (bool, error) {
+	val, ok, err := s.Get(key)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, json.Unmarshal([]byte(val), v)
+}
+
+// Save encode v to json as the value of the key
+func (s *Session) Save(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Set(key, string(b))
+}
@@ -0,0 +1,110 @@
+package session
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func stores(t *testing.T) map[string]Store {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemoryStore(0), "file": fs}
+}
+
+func TestStore(t *testing.T) {
+	tests := []struct {
+		name string
+		do   func(s Store) error
+		want map[string]string
+	}{
+		{"set", func(s Store) error {
+			return s.Set("a", "k", "v")
+		}, map[string]string{"k": "v"}},
+		{"overwrite", func(s Store) error {
+			_ = s.Set("a", "k", "v")
+			return s.Set("a", "k", "v2")
+		}, map[string]string{"k": "v2"}},
+		{"del", func(s Store) error {
+			_ = s.Set("a", "k", "v")
+			_ = s.Set("a", "k2", "v2")
+			return s.Del("a", "k", "missing")
+		}, map[string]string{"k2": "v2"}},
+		{"del all", func(s Store) error {
+			_ = s.Set("a", "k", "v")
+			return s.Del("a", "k")
+		}, map[string]string{}},
+		{"clear", func(s Store) error {
+			_ = s.Set("a", "k", "v")
+			return s.Clear("a")
+		}, map[string]string{}},
+		{"other session", func(s Store) error {
+			return s.Set("b", "k", "v")
+		}, map[string]string{}},
+		{"sid with separators", func(s Store) error {
+			_ = s.Set("a/../b", "k", "x")
+			return s.Set("a", "k", "v")
+		}, map[string]string{"k": "v"}},
+	}
+	for _, tt := range tests {
+		for kind, s := range stores(t) {
+			if err := tt.do(s); err != nil {
+				t.Errorf("%s %s: err = %v", kind, tt.name, err)
+				continue
+			}
+			got, err := s.All("a")
+			if err != nil {
+				t.Errorf("%s %s: All() err = %v", kind, tt.name, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s %s: All() = %v, want %v", kind, tt.name, got, tt.want)
+			}
+			v, ok, _ := s.Get("a", "k")
+			if want, wantOk := tt.want["k"]; v != want || ok != wantOk {
+				t.Errorf("%s %s: Get(k) = %q %v, want %q %v", kind, tt.name, v, ok, want, wantOk)
+			}
+		}
+	}
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	s := NewMemoryStore(100 * time.Millisecond)
+	_ = s.Set("a", "k", "v")
+	_ = s.Set("b", "k", "v")
+	time.Sleep(60 * time.Millisecond)
+	if _, ok, _ := s.Get("a", "k"); !ok {
+		t.Fatal("session a expired before the ttl")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok, _ := s.Get("a", "k"); !ok {
+		t.Error("session a expired after being accessed, want refreshed")
+	}
+	if _, ok, _ := s.Get("b", "k"); ok {
+		t.Error("session b not expired after the ttl")
+	}
+}
+
+func TestSession(t *testing.T) {
+	m := NewManager(NewMemoryStore(0))
+	type value struct {
+		N int
+	}
+	if err := m.Bind("uid", "1").Save("v", value{N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var got value
+	if ok, err := m.Bind("uid", "1").Load("v", &got); !ok || err != nil || got.N != 1 {
+		t.Errorf("Load() = %v %v %+v, want true nil {N:1}", ok, err, got)
+	}
+	if ok, _ := m.Conn("gw", 1).Load("v", &got); ok {
+		t.Error("the connection session shares the bound id session")
+	}
+	var nilSession *Session
+	if err := nilSession.Set("k", "v"); !errors.Is(err, ErrNoStore) {
+		t.Errorf("nil session Set() = %v, want %v", err, ErrNoStore)
+	}
+}